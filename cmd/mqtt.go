@@ -0,0 +1,44 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package cmd
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/joshuar/go-hass-agent/cmd/text"
+	"github.com/joshuar/go-hass-agent/internal/agent"
+	"github.com/joshuar/go-hass-agent/internal/logging"
+)
+
+// mqttCmd groups the commands for working with the MQTT integration.
+var mqttCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "Work with the MQTT integration",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		logging.SetLoggingLevel(traceFlag, debugFlag, profileFlag)
+	},
+}
+
+// mqttUnregisterCmd represents the mqtt unregister command.
+var mqttUnregisterCmd = &cobra.Command{
+	Use:   "unregister",
+	Short: "Remove the agent's MQTT entities from Home Assistant",
+	Long:  text.MQTTUnregisterCmdLongText,
+	Run: func(cmd *cobra.Command, args []string) {
+		agent := agent.New(&agent.Options{
+			Headless: true,
+			ID:       AppID,
+		})
+		if err := agent.UnregisterMQTT(); err != nil {
+			log.Fatal().Err(err).Msg("Could not unregister from MQTT.")
+		}
+	},
+}
+
+func init() {
+	mqttCmd.AddCommand(mqttUnregisterCmd)
+}
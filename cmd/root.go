@@ -71,6 +71,8 @@ func init() {
 
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(registerCmd)
+	rootCmd.AddCommand(scriptsCmd)
+	rootCmd.AddCommand(mqttCmd)
 }
 
 func defaultHeadless() bool {
@@ -0,0 +1,101 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/joshuar/go-hass-agent/cmd/text"
+	"github.com/joshuar/go-hass-agent/internal/logging"
+	"github.com/joshuar/go-hass-agent/internal/scripts"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+var (
+	streamDurationFlag time.Duration
+	runCommandsFlag    bool
+)
+
+// scriptsCmd groups the commands for working with script sensors.
+var scriptsCmd = &cobra.Command{
+	Use:   "scripts",
+	Short: "Work with script sensors",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		logging.SetLoggingLevel(traceFlag, debugFlag, profileFlag)
+	},
+}
+
+// scriptsTestCmd represents the scripts test command.
+var scriptsTestCmd = &cobra.Command{
+	Use:   "test [script...]",
+	Short: "Run scripts and show the sensors they would send to Home Assistant",
+	Long:  text.ScriptsTestCmdLongText,
+	Run: func(cmd *cobra.Command, args []string) {
+		paths := args
+		if len(paths) == 0 {
+			var err error
+			if paths, err = scripts.ScriptPaths(filepath.Join(xdg.ConfigHome, AppID, "scripts")); err != nil {
+				log.Fatal().Err(err).Msg("Could not find scripts.")
+			}
+			if len(paths) == 0 {
+				log.Fatal().Msg("No scripts found.")
+			}
+		}
+		var failed bool
+		for _, path := range paths {
+			if !testScript(cmd.Context(), path) {
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// testScript checks the script at the given path, printing the payloads of any
+// valid sensors and logging any problems. It returns false if there were any
+// problems.
+func testScript(ctx context.Context, path string) bool {
+	sensors, err := scripts.Check(ctx, path, scripts.CheckOptions{
+		StreamDuration: streamDurationFlag,
+		RunCommands:    runCommandsFlag,
+	})
+	for _, s := range sensors {
+		payload, err := json.MarshalIndent(tracker.RegistrationPayload(s), "", "  ")
+		if err != nil {
+			log.Error().Err(err).Str("script", path).Str("sensor", s.Name()).
+				Msg("Could not marshal sensor payload.")
+			return false
+		}
+		fmt.Println(string(payload))
+	}
+	if err != nil {
+		log.Error().Err(err).Str("script", path).Msg("Script has problems.")
+		return false
+	}
+	log.Info().Str("script", path).Int("sensors", len(sensors)).Msg("Script OK.")
+	return true
+}
+
+func init() {
+	scriptsTestCmd.Flags().DurationVar(&streamDurationFlag,
+		"stream-duration", 10*time.Second,
+		"How long to run streaming scripts for when testing them.")
+	scriptsTestCmd.Flags().BoolVar(&runCommandsFlag,
+		"run-commands", false,
+		"Also run scripts that are only commands (i.e., have no schedule).")
+	scriptsCmd.AddCommand(scriptsTestCmd)
+}
@@ -12,3 +12,9 @@ var RegisterCmdLongText string
 
 //go:embed rootLong.txt
 var RootCmdLongText string
+
+//go:embed scriptsTestLong.txt
+var ScriptsTestCmdLongText string
+
+//go:embed mqttUnregisterLong.txt
+var MQTTUnregisterCmdLongText string
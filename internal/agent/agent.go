@@ -7,6 +7,8 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -17,7 +19,10 @@ import (
 	"github.com/rs/zerolog/log"
 
 	fyneui "github.com/joshuar/go-hass-agent/internal/agent/ui/fyneUI"
+	mqttclient "github.com/joshuar/go-hass-agent/internal/mqtt"
 	"github.com/joshuar/go-hass-agent/internal/preferences"
+	"github.com/joshuar/go-hass-agent/internal/scripts"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
 )
 
 // Agent holds the data and structure representing an instance of the agent.
@@ -53,13 +58,26 @@ func New(o *Options) *Agent {
 func (agent *Agent) Run(trk SensorTracker) {
 	var wg sync.WaitGroup
 	preferences.SetPath(filepath.Join(xdg.ConfigHome, agent.AppID()))
+	preferences.SetStatePath(filepath.Join(xdg.StateHome, agent.AppID()))
 
 	// Pre-flight: check if agent is registered. If not, run registration flow.
 	var regWait sync.WaitGroup
 	regWait.Add(1)
 	go func() {
 		defer regWait.Done()
+		// If sensors are published over MQTT, the agent can run without
+		// being registered with the mobile_app integration.
+		prefs, _ := preferences.Load()
+		mqttOnly := prefs.MQTTEnabled && prefs.MQTTSensors
+		if mqttOnly && !prefs.Registered && !agent.Options.ForceRegister {
+			log.Info().Msg("Agent is not registered with Home Assistant. Sensors will only be published via MQTT.")
+			return
+		}
 		if err := agent.checkRegistration(trk); err != nil {
+			if mqttOnly {
+				log.Warn().Err(err).Msg("Could not register with Home Assistant. Sensors will only be published via MQTT.")
+				return
+			}
 			log.Fatal().Err(err).Msg("Error checking registration status.")
 		}
 	}()
@@ -83,29 +101,56 @@ func (agent *Agent) Run(trk SensorTracker) {
 			cancelFunc()
 		}()
 
+		// If sensors are to be published over MQTT, the connection needs to
+		// be established before any workers are started.
+		var mqttClient *mqttclient.Client
+		if prefs.MQTTEnabled && prefs.MQTTSensors {
+			if mqttClient, err = newMQTTClient(runnerCtx); err != nil {
+				if !prefs.Registered {
+					log.Fatal().Err(err).Msg("Could not start MQTT client and agent is not registered with Home Assistant.")
+				}
+				log.Error().Err(err).Msg("Could not start MQTT client. Sensors will be sent via the Mobile App integration.")
+			} else {
+				publisher := newMQTTSensorPublisher(mqttClient)
+				// If the broker has lost the sensor configs, they are
+				// published again with the next update of each sensor.
+				mqttClient.OnConnect(publisher.forget)
+				runnerCtx = tracker.EmbedPublisherInContext(runnerCtx, publisher)
+				// The client is shared by the sensor publisher and the MQTT
+				// worker, so it is only disconnected once the agent stops.
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-runnerCtx.Done()
+					mqttClient.Disconnect()
+				}()
+			}
+		}
+
+		scriptsRunner := scripts.NewRunner(runnerCtx, filepath.Join(xdg.ConfigHome, agent.AppID(), "scripts"))
 		// Start worker funcs for sensors.
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			runWorkers(runnerCtx, trk)
+			runWorkers(runnerCtx, trk, scriptsRunner)
 		}()
 		// Start any scripts.
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			scriptPath := filepath.Join(xdg.ConfigHome, agent.AppID(), "scripts")
-			runScripts(runnerCtx, scriptPath, trk)
+			runScripts(runnerCtx, scriptsRunner, trk)
 		}()
 		// Start the mqtt client
 		if prefs.MQTTEnabled {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				runMQTTWorker(runnerCtx)
+				runMQTTWorker(runnerCtx, mqttClient, scriptsRunner)
 			}()
 		}
-		// Listen for notifications from Home Assistant.
-		if !agent.IsHeadless() {
+		// Listen for notifications from Home Assistant. These need the
+		// mobile_app integration.
+		if !agent.IsHeadless() && prefs.Registered {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -141,6 +186,24 @@ func (agent *Agent) Register(trk SensorTracker) {
 	agent.Stop()
 }
 
+// UnregisterMQTT will remove all entities the agent has published via MQTT
+// from Home Assistant. They will be published again the next time the agent
+// runs with MQTT enabled.
+func (agent *Agent) UnregisterMQTT() error {
+	preferences.SetPath(filepath.Join(xdg.ConfigHome, agent.AppID()))
+	preferences.SetStatePath(filepath.Join(xdg.StateHome, agent.AppID()))
+	prefs, err := preferences.Load()
+	if err != nil {
+		return fmt.Errorf("could not load preferences: %w", err)
+	}
+	if !prefs.MQTTEnabled {
+		return errors.New("MQTT is not enabled")
+	}
+	ctx, cancelFunc := setupContext(prefs)
+	defer cancelFunc()
+	return resetMQTTWorker(ctx)
+}
+
 // handleSignals will handle Ctrl-C of the agent.
 func (agent *Agent) handleSignals() {
 	c := make(chan os.Signal, 1)
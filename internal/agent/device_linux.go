@@ -15,11 +15,15 @@ import (
 	"github.com/joshuar/go-hass-agent/internal/linux/cpu"
 	"github.com/joshuar/go-hass-agent/internal/linux/disk"
 	"github.com/joshuar/go-hass-agent/internal/linux/location"
+	"github.com/joshuar/go-hass-agent/internal/linux/media"
 	"github.com/joshuar/go-hass-agent/internal/linux/mem"
 	"github.com/joshuar/go-hass-agent/internal/linux/net"
 	"github.com/joshuar/go-hass-agent/internal/linux/power"
+	"github.com/joshuar/go-hass-agent/internal/linux/pressure"
 	"github.com/joshuar/go-hass-agent/internal/linux/problems"
+	"github.com/joshuar/go-hass-agent/internal/linux/process"
 	"github.com/joshuar/go-hass-agent/internal/linux/system"
+	"github.com/joshuar/go-hass-agent/internal/linux/systemd"
 	"github.com/joshuar/go-hass-agent/internal/linux/time"
 	"github.com/joshuar/go-hass-agent/internal/linux/user"
 	"github.com/joshuar/go-hass-agent/internal/preferences"
@@ -39,16 +43,23 @@ func sensorWorkers() []func(context.Context) chan tracker.Sensor {
 		apps.Updater,
 		net.ConnectionsUpdater,
 		net.RatesUpdater,
+		net.UsageUpdater,
 		problems.Updater,
 		mem.Updater,
 		cpu.LoadAvgUpdater,
 		cpu.UsageUpdater,
+		pressure.Updater,
 		disk.UsageUpdater,
+		disk.IOUpdater,
 		time.Updater,
 		power.ScreenLockUpdater,
 		power.PowerStateUpdater,
 		power.PowerProfileUpdater,
+		power.InhibitorsUpdater,
 		user.Updater,
+		media.Updater,
+		systemd.Updater,
+		process.Updater,
 		system.Versions,
 		// system.TempUpdater,
 		system.HWSensorUpdater,
@@ -60,7 +71,8 @@ func locationWorker() func(context.Context) chan *hass.LocationData {
 	return location.Updater
 }
 
-// Setup returns a new Context that contains the D-Bus API.
+// Setup returns a new Context that contains the D-Bus API and the media player
+// monitor shared by the media sensors and controls.
 func setupDeviceContext(ctx context.Context) context.Context {
-	return dbusx.Setup(ctx)
+	return media.Setup(dbusx.Setup(ctx))
 }
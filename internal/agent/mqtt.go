@@ -6,6 +6,10 @@
 package agent
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
+
 	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
 	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
 	"github.com/rs/zerolog/log"
@@ -13,8 +17,98 @@ import (
 	"github.com/joshuar/go-hass-agent/internal/preferences"
 )
 
+// mqttAppName is the app name used in the topics of all entities the agent
+// publishes to MQTT.
+const mqttAppName = "go_hass_agent"
+
+// mqttEntity is the discovery config for an entity published over MQTT. It
+// adds the fields not supported by mqtthass.Entity. Every entity references
+// the availability topic of the agent, so that Home Assistant shows them as
+// unavailable when the agent is not running.
+type mqttEntity struct {
+	*mqtthass.Entity
+	AvailabilityTopic string             `json:"availability_topic,omitempty"`
+	Availability      []mqttAvailability `json:"availability,omitempty"`
+	AvailabilityMode  string             `json:"availability_mode,omitempty"`
+	EnabledByDefault  *bool              `json:"enabled_by_default,omitempty"`
+	Options           []string           `json:"options,omitempty"`
+	Min               *float64           `json:"min,omitempty"`
+	Max               *float64           `json:"max,omitempty"`
+	Step              *float64           `json:"step,omitempty"`
+	Mode              string             `json:"mode,omitempty"`
+}
+
+// mqttAvailability is one of the topics an entity's availability depends on,
+// when it depends on more than the availability of the agent.
+type mqttAvailability struct {
+	Topic string `json:"topic"`
+}
+
+func newMQTTEntity(e *mqtthass.Entity) *mqttEntity {
+	return &mqttEntity{
+		Entity:            e,
+		AvailabilityTopic: mqttAvailabilityTopic(),
+	}
+}
+
+// marshalMQTTConfig marshals the discovery config message for the given
+// entity. Any extra config not supported by mqtthass.Entity is taken from the
+// given extras, which may be nil.
+func marshalMQTTConfig(c *mqtthass.EntityConfig, extras *mqttEntity) (*mqttapi.Msg, error) {
+	entity := newMQTTEntity(c.Entity)
+	if extras != nil {
+		e := *extras
+		e.Entity = entity.Entity
+		e.AvailabilityTopic = entity.AvailabilityTopic
+		entity = &e
+	}
+	config, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	return mqttapi.NewMsg(c.ConfigTopic, config).Retain(), nil
+}
+
+// newMQTTEntityConfig creates the config for an entity of the given Home
+// Assistant component (e.g., select) that has both a state and command topic.
+// It is used for the components mqtthass has no builder for.
+func newMQTTEntityConfig(component, id string) *mqtthass.EntityConfig {
+	prefix := strings.Join([]string{mqttapi.DiscoveryPrefix, component, mqttAppName, id}, "/")
+	cfg := mqtthass.NewEntityByID(id, mqttAppName).
+		WithDefaultOriginInfo().
+		WithDeviceInfo(mqttDevice()).
+		WithValueTemplate("{{ value }}")
+	cfg.ConfigTopic = prefix + "/config"
+	cfg.Entity.StateTopic = prefix + "/state"
+	cfg.Entity.CommandTopic = prefix + "/set"
+	return cfg
+}
+
+// mqttStateWatcher publishes the state of one or more entities whenever it
+// changes, until the context is canceled.
+type mqttStateWatcher func(ctx context.Context, client mqtthass.MQTTClient)
+
 type mqttObj struct {
 	entities map[string]*mqtthass.EntityConfig
+	// extras holds, by entity ID, any config for the entities that is not
+	// supported by mqtthass.Entity.
+	extras map[string]*mqttEntity
+	// watchers are started once the entities have been published.
+	watchers []mqttStateWatcher
+	// destructive marks, by entity ID, the destructive actions (e.g., reboot).
+	// They must be confirmed by the user before they are run, if confirmation
+	// is enabled in the preferences, and are subject to the cooldown.
+	destructive map[string]bool
+	// guard, if set, checks every command received for the entities before
+	// it is acted on.
+	guard *mqttCommandGuard
+}
+
+// watch starts the state watchers of the object.
+func (o *mqttObj) watch(ctx context.Context, client mqtthass.MQTTClient) {
+	for _, watcher := range o.watchers {
+		go watcher(ctx, client)
+	}
 }
 
 func (o *mqttObj) Name() string {
@@ -24,7 +118,7 @@ func (o *mqttObj) Name() string {
 func (o *mqttObj) Configuration() []*mqttapi.Msg {
 	var msgs []*mqttapi.Msg
 	for id, c := range o.entities {
-		if msg, err := mqtthass.MarshalConfig(c); err != nil {
+		if msg, err := marshalMQTTConfig(c, o.extras[id]); err != nil {
 			log.Error().Err(err).Msgf("Failed to marshal payload for %s.", id)
 		} else {
 			msgs = append(msgs, msg)
@@ -35,12 +129,15 @@ func (o *mqttObj) Configuration() []*mqttapi.Msg {
 
 func (o *mqttObj) Subscriptions() []*mqttapi.Subscription {
 	var subs []*mqttapi.Subscription
-	for _, v := range o.entities {
+	for id, v := range o.entities {
 		if v.CommandCallback != nil {
 			if sub, err := mqtthass.MarshalSubscription(v); err != nil {
 				log.Error().Err(err).Str("entity", v.Entity.Name).
 					Msg("Error adding subscription.")
 			} else {
+				if o.guard != nil {
+					sub.Callback = o.guard.wrap(id, v, sub.Callback)
+				}
 				subs = append(subs, sub)
 			}
 		}
@@ -0,0 +1,181 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+
+	"github.com/joshuar/go-hass-agent/internal/device/helpers"
+	"github.com/joshuar/go-hass-agent/internal/linux/backlight"
+)
+
+const (
+	screenBrightnessID   = "screen_brightness"
+	keyboardBrightnessID = "keyboard_brightness"
+
+	// screenBrightnessMin is the lowest brightness (in percent) that can be set
+	// from Home Assistant, so that the display cannot be turned off entirely.
+	screenBrightnessMin = 1
+	// screenBrightnessPoll is how often the display brightness is checked for
+	// changes, as sysfs does not report them.
+	screenBrightnessPoll = 5 * time.Second
+)
+
+// addBacklightNumbers adds number entities to the object for controlling the
+// brightness of the display and keyboard backlights, if the device has them.
+func addBacklightNumbers(ctx context.Context, o *mqttObj) {
+	if display, err := backlight.GetDisplay(); err != nil {
+		log.Debug().Err(err).Msg("No display backlight. Will not add screen brightness control.")
+	} else {
+		addScreenBrightness(ctx, o, display)
+	}
+	if keyboard, err := backlight.GetKeyboard(ctx); err != nil {
+		log.Debug().Err(err).Msg("No keyboard backlight. Will not add keyboard brightness control.")
+	} else {
+		addKeyboardBrightness(ctx, o, keyboard)
+	}
+}
+
+// addScreenBrightness adds a number entity for the display brightness, as a
+// percentage of the maximum brightness.
+func addScreenBrightness(ctx context.Context, o *mqttObj, display *backlight.Display) {
+	toPercent := func(brightness int) int {
+		return int(math.Round(float64(brightness) * 100 / float64(display.MaxBrightness())))
+	}
+	// fromPercent converts a percentage to a brightness, clamped to between
+	// screenBrightnessMin and 100 percent. The brightness is never 0, even
+	// if screenBrightnessMin rounds down to it.
+	fromPercent := func(percent float64) int {
+		percent = math.Min(math.Max(percent, screenBrightnessMin), 100)
+		return max(int(math.Round(percent*float64(display.MaxBrightness())/100)), 1)
+	}
+
+	cfg := newMQTTEntityConfig("number", screenBrightnessID).
+		WithIcon("mdi:brightness-6").
+		WithUnits("%")
+	publisher := newNumberPublisher(cfg)
+	cfg.WithCommandCallback(func(_ MQTT.Client, msg MQTT.Message) {
+		percent, err := strconv.ParseFloat(string(msg.Payload()), 64)
+		if err == nil && (math.IsNaN(percent) || math.IsInf(percent, 0)) {
+			err = strconv.ErrRange
+		}
+		if err != nil {
+			log.Warn().Err(err).Msg("Invalid screen brightness.")
+			return
+		}
+		if err := display.SetBrightness(ctx, fromPercent(percent)); err != nil {
+			log.Warn().Err(err).Msg("Could not set screen brightness.")
+			return
+		}
+		if brightness, err := display.Brightness(); err == nil {
+			publisher.publish(toPercent(brightness))
+		}
+	})
+
+	o.entities[screenBrightnessID] = cfg
+	o.extras[screenBrightnessID] = newNumberExtras(screenBrightnessMin, 100)
+	o.watchers = append(o.watchers, func(ctx context.Context, client mqtthass.MQTTClient) {
+		publisher.setClient(client)
+		helpers.PollSensors(ctx, func(_ time.Duration) {
+			brightness, err := display.Brightness()
+			if err != nil {
+				log.Debug().Err(err).Msg("Could not read screen brightness.")
+				return
+			}
+			publisher.publish(toPercent(brightness))
+		}, screenBrightnessPoll, time.Second)
+	})
+}
+
+// addKeyboardBrightness adds a number entity for the keyboard brightness, in
+// the levels supported by the keyboard backlight.
+func addKeyboardBrightness(ctx context.Context, o *mqttObj, keyboard *backlight.Keyboard) {
+	cfg := newMQTTEntityConfig("number", keyboardBrightnessID).
+		WithIcon("mdi:keyboard")
+	publisher := newNumberPublisher(cfg)
+	cfg.WithCommandCallback(func(_ MQTT.Client, msg MQTT.Message) {
+		level, err := strconv.ParseFloat(string(msg.Payload()), 64)
+		if err != nil {
+			log.Warn().Err(err).Msg("Invalid keyboard brightness.")
+			return
+		}
+		if err := keyboard.SetBrightness(ctx, int(math.Round(level))); err != nil {
+			log.Warn().Err(err).Msg("Could not set keyboard brightness.")
+		}
+	})
+
+	o.entities[keyboardBrightnessID] = cfg
+	o.extras[keyboardBrightnessID] = newNumberExtras(0, keyboard.MaxBrightness())
+	o.watchers = append(o.watchers, func(ctx context.Context, client mqtthass.MQTTClient) {
+		publisher.setClient(client)
+		if brightness, err := keyboard.Brightness(ctx); err != nil {
+			log.Debug().Err(err).Msg("Could not read keyboard brightness.")
+		} else {
+			publisher.publish(brightness)
+		}
+		if err := keyboard.Watch(ctx, publisher.publish); err != nil {
+			log.Warn().Err(err).Msg("Could not watch keyboard brightness. Changes will not be reported.")
+		}
+	})
+}
+
+// newNumberExtras returns the config for a number entity shown as a slider
+// with the given range.
+func newNumberExtras(minValue, maxValue int) *mqttEntity {
+	minF, maxF, step := float64(minValue), float64(maxValue), 1.0
+	return &mqttEntity{
+		Min:  &minF,
+		Max:  &maxF,
+		Step: &step,
+		Mode: "slider",
+	}
+}
+
+// numberPublisher publishes the state of a number entity, if it has changed
+// since it was last published.
+type numberPublisher struct {
+	client mqtthass.MQTTClient
+	topic  string
+	last   int
+	mu     sync.Mutex
+}
+
+func newNumberPublisher(cfg *mqtthass.EntityConfig) *numberPublisher {
+	return &numberPublisher{
+		topic: cfg.Entity.StateTopic,
+		last:  -1,
+	}
+}
+
+func (p *numberPublisher) setClient(client mqtthass.MQTTClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.client = client
+}
+
+func (p *numberPublisher) publish(value int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client == nil || value == p.last {
+		return
+	}
+	msg := mqttapi.NewMsg(p.topic, []byte(strconv.Itoa(value))).Retain()
+	if err := p.client.Publish(msg); err != nil {
+		log.Warn().Err(err).Str("topic", p.topic).Msg("Could not publish number state.")
+		return
+	}
+	p.last = value
+}
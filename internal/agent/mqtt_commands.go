@@ -0,0 +1,228 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+
+	"github.com/joshuar/go-hass-agent/internal/device/helpers"
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+)
+
+const (
+	// mqttCommandTimeout is how long a user-defined command is allowed to run.
+	mqttCommandTimeout = 30 * time.Second
+	// mqttCommandOutputMax is the maximum amount of output (in bytes) of a
+	// user-defined command that is logged and reported.
+	mqttCommandOutputMax = 4096
+
+	switchOn  = "ON"
+	switchOff = "OFF"
+)
+
+// mqttCommandResult is the result of running a user-defined command. It is
+// reported as the attributes of the entity, if requested.
+type mqttCommandResult struct {
+	LastRun  time.Time `json:"last_run"`
+	Output   string    `json:"output"`
+	ExitCode int       `json:"exit_code"`
+}
+
+// mqttCommand is a user-defined command that has been added as an entity.
+type mqttCommand struct {
+	client mqtthass.MQTTClient
+	cfg    *mqtthass.EntityConfig
+	preferences.MQTTCommand
+	mu sync.Mutex
+	// running ensures only one run of the command is handled at a time, so
+	// that the published state matches the last command received.
+	running sync.Mutex
+}
+
+// addMQTTCommands adds an entity to the object for each of the user-defined
+// commands in the preferences.
+func addMQTTCommands(ctx context.Context, o *mqttObj) {
+	prefs := preferences.FetchFromContext(ctx)
+	for _, command := range prefs.MQTT.Commands {
+		id := command.ID()
+		c := &mqttCommand{MQTTCommand: command}
+		c.cfg = newMQTTEntityConfig(command.Type, id).
+			WithIcon(command.Icon).
+			WithCommandCallback(func(_ MQTT.Client, msg MQTT.Message) {
+				// Run the command in the background so other MQTT messages
+				// are not held up while it runs.
+				go c.handle(ctx, string(msg.Payload()))
+			})
+		c.cfg.Entity.Name = command.Name
+		if command.Type == preferences.MQTTCommandButton {
+			c.cfg.Entity.StateTopic = ""
+		}
+		if command.ReportOutput {
+			c.cfg.Entity.AttributesTopic = strings.TrimSuffix(c.cfg.ConfigTopic, "/config") + "/attributes"
+		}
+		if command.Type == preferences.MQTTCommandNumber {
+			c.cfg.WithUnits(command.Units)
+			o.extras[id] = &mqttEntity{
+				Min:  command.Min,
+				Max:  command.Max,
+				Step: command.Step,
+			}
+		}
+
+		o.entities[id] = c.cfg
+		o.watchers = append(o.watchers, c.watch)
+		log.Debug().Str("command", command.Name).Str("type", command.Type).Msg("Added MQTT command.")
+	}
+}
+
+// watch sets the client the command publishes its state with. For a switch
+// with a state command, it publishes the current state and, if an interval is
+// set, polls for changes.
+func (c *mqttCommand) watch(ctx context.Context, client mqtthass.MQTTClient) {
+	c.mu.Lock()
+	c.client = client
+	c.mu.Unlock()
+	if c.Type != preferences.MQTTCommandSwitch || len(c.StateCommand) == 0 {
+		return
+	}
+	c.updateSwitchState(ctx)
+	if c.StateInterval > 0 {
+		helpers.PollSensors(ctx, func(_ time.Duration) {
+			c.updateSwitchState(ctx)
+		}, time.Duration(c.StateInterval)*time.Second, time.Second)
+	}
+}
+
+// handle runs the command for the given payload received on the command
+// topic of the entity and publishes the new state.
+func (c *mqttCommand) handle(ctx context.Context, payload string) {
+	c.running.Lock()
+	defer c.running.Unlock()
+	switch c.Type {
+	case preferences.MQTTCommandButton:
+		c.run(ctx, c.Command)
+	case preferences.MQTTCommandSwitch:
+		command := c.OffCommand
+		if payload == switchOn {
+			command = c.OnCommand
+		}
+		err := c.run(ctx, command)
+		switch {
+		case len(c.StateCommand) > 0:
+			c.updateSwitchState(ctx)
+		case err == nil:
+			c.publishState(payload)
+		}
+	case preferences.MQTTCommandText, preferences.MQTTCommandNumber:
+		if err := c.run(ctx, c.Command, payload); err == nil {
+			c.publishState(payload)
+		}
+	}
+}
+
+// updateSwitchState runs the state command of a switch and publishes the
+// resulting state. As the state command exits unsuccessfully whenever the
+// switch is off, that is not logged as a failure.
+func (c *mqttCommand) updateSwitchState(ctx context.Context) {
+	result, err := c.execute(ctx, c.StateCommand)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		c.publishState(switchOn)
+	case errors.As(err, &exitErr):
+		c.publishState(switchOff)
+	default:
+		log.Warn().Err(err).Str("command", c.Name).Str("output", result.Output).
+			Msg("Could not run MQTT command state command.")
+	}
+}
+
+// run runs the given command, passing the given value (if any) to it. The
+// output and exit status are logged and, if requested, published as
+// attributes.
+func (c *mqttCommand) run(ctx context.Context, command []string, value ...string) error {
+	result, err := c.execute(ctx, command, value...)
+	logger := log.With().Str("command", c.Name).Int("exit_code", result.ExitCode).Str("output", result.Output).Logger()
+	if err != nil {
+		logger.Warn().Err(err).Msg("MQTT command failed.")
+	} else {
+		logger.Debug().Msg("MQTT command ran.")
+	}
+	if c.ReportOutput {
+		c.publishResult(result)
+	}
+	return err
+}
+
+// execute runs the given command, passing the given value (if any) as the
+// last argument or in the environment variable set by the user, and returns
+// its result.
+func (c *mqttCommand) execute(ctx context.Context, command []string, value ...string) (*mqttCommandResult, error) {
+	result := &mqttCommandResult{
+		LastRun:  time.Now(),
+		ExitCode: -1,
+	}
+	if len(command) == 0 {
+		return result, errors.New("no command")
+	}
+	ctx, cancelFunc := context.WithTimeout(ctx, mqttCommandTimeout)
+	defer cancelFunc()
+
+	args := command[1:]
+	env := os.Environ()
+	if len(value) > 0 {
+		if c.ValueEnv != "" {
+			env = append(env, c.ValueEnv+"="+value[0])
+		} else {
+			args = append(args[:len(args):len(args)], value[0])
+		}
+	}
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.Env = env
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+
+	result.Output = string(output[:min(len(output), mqttCommandOutputMax)])
+	result.ExitCode = cmd.ProcessState.ExitCode()
+	return result, err
+}
+
+func (c *mqttCommand) publishState(state string) {
+	c.publish(c.cfg.Entity.StateTopic, []byte(state))
+}
+
+func (c *mqttCommand) publishResult(result *mqttCommandResult) {
+	attributes, err := json.Marshal(result)
+	if err != nil {
+		log.Warn().Err(err).Str("command", c.Name).Msg("Could not marshal MQTT command result.")
+		return
+	}
+	c.publish(c.cfg.Entity.AttributesTopic, attributes)
+}
+
+func (c *mqttCommand) publish(topic string, payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil || topic == "" {
+		return
+	}
+	if err := c.client.Publish(mqttapi.NewMsg(topic, payload).Retain()); err != nil {
+		log.Warn().Err(err).Str("command", c.Name).Msg("Could not publish MQTT command state.")
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+)
+
+const (
+	// mqttDiscoveryTopics matches the config topics of every entity the agent
+	// publishes via MQTT discovery.
+	mqttDiscoveryTopics = "homeassistant/+/" + mqttAppName + "/+/config"
+	// mqttRetainedWait is how long to wait for the broker to send any retained
+	// config messages when unregistering.
+	mqttRetainedWait = 2 * time.Second
+	// mqttDiscoveryStateFile is the file, in the state directory, that records
+	// the entities last published via MQTT discovery.
+	mqttDiscoveryStateFile = "mqtt-discovery.json"
+)
+
+// mqttDiscoveryState records the hash and config topics of the entities last
+// published to Home Assistant via MQTT discovery. An empty hash means no
+// entities have been published. It is kept in the state directory rather
+// than the preferences, as it is not set by the user.
+type mqttDiscoveryState struct {
+	Hash   string   `json:"hash"`
+	Topics []string `json:"topics"`
+	path   string
+}
+
+// loadMQTTDiscoveryState loads the state saved in the state directory. If
+// there is no saved state, or it cannot be read, an empty state is returned.
+func loadMQTTDiscoveryState() (*mqttDiscoveryState, error) {
+	s := &mqttDiscoveryState{
+		path: filepath.Join(preferences.GetStatePath(), mqttDiscoveryStateFile),
+	}
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// save writes the state to disk, replacing any previously saved state.
+func (s *mqttDiscoveryState) save() error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// publishMQTTDiscovery publishes the discovery configs of the entities in the
+// given object. The configs are always published, in case they have been lost
+// by the broker. A hash of the configs is stored in the state directory and, if
+// it has changed since they were last published, any entities published
+// previously but no longer present have an empty config published, which
+// removes them from Home Assistant.
+func publishMQTTDiscovery(o *mqttObj, c mqtthass.MQTTClient) error {
+	state, err := loadMQTTDiscoveryState()
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not load MQTT discovery state. Entities that no longer exist will not be removed.")
+	}
+
+	msgs := o.Configuration()
+	hash, topics := mqttDiscoveryHash(msgs)
+	changed := hash != state.Hash
+	if changed {
+		for _, topic := range state.Topics {
+			if !slices.Contains(topics, topic) {
+				log.Debug().Str("topic", topic).Msg("Removing MQTT entity.")
+				msgs = append(msgs, mqttapi.NewMsg(topic, []byte{}).Retain())
+			}
+		}
+	}
+
+	log.Debug().Msg("Publishing MQTT discovery configs.")
+	if err := c.Publish(msgs...); err != nil {
+		return fmt.Errorf("could not publish discovery configs: %w", err)
+	}
+	if changed {
+		state.Hash, state.Topics = hash, topics
+		if err := state.save(); err != nil {
+			log.Warn().Err(err).Msg("Could not save MQTT discovery state.")
+		}
+	}
+	return nil
+}
+
+// mqttDiscoveryHash returns a hash of the given discovery config messages and
+// their (sorted) topics. The hash does not depend on the order of the
+// messages.
+func mqttDiscoveryHash(msgs []*mqttapi.Msg) (string, []string) {
+	sorted := slices.Clone(msgs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Topic < sorted[j].Topic
+	})
+
+	h := sha256.New()
+	topics := make([]string, 0, len(sorted))
+	for _, msg := range sorted {
+		h.Write([]byte(msg.Topic))
+		h.Write([]byte{0})
+		h.Write(msg.Message)
+		h.Write([]byte{0})
+		topics = append(topics, msg.Topic)
+	}
+	return hex.EncodeToString(h.Sum(nil)), topics
+}
+
+// clearMQTTDiscovery removes every entity the agent has published via MQTT
+// discovery from Home Assistant, including any sensors and script buttons, by
+// publishing an empty config for each of them. The entities are found from
+// the retained configs on the broker and the topics recorded in the state
+// directory.
+func clearMQTTDiscovery(ctx context.Context, c mqtthass.MQTTClient) error {
+	state, err := loadMQTTDiscoveryState()
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not load MQTT discovery state. Only entities retained by the broker will be removed.")
+	}
+
+	var mu sync.Mutex
+	topics := slices.Clone(state.Topics)
+	sub := &mqttapi.Subscription{
+		Topic: mqttDiscoveryTopics,
+		Callback: func(_ MQTT.Client, msg MQTT.Message) {
+			if !msg.Retained() || len(msg.Payload()) == 0 {
+				return
+			}
+			mu.Lock()
+			topics = append(topics, msg.Topic())
+			mu.Unlock()
+		},
+	}
+	if err := c.Subscribe(sub); err != nil {
+		return fmt.Errorf("could not find published entities: %w", err)
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(mqttRetainedWait):
+	}
+
+	mu.Lock()
+	slices.Sort(topics)
+	topics = slices.Compact(topics)
+	msgs := make([]*mqttapi.Msg, 0, len(topics))
+	for _, topic := range topics {
+		log.Debug().Str("topic", topic).Msg("Removing MQTT entity.")
+		msgs = append(msgs, mqttapi.NewMsg(topic, []byte{}).Retain())
+	}
+	mu.Unlock()
+
+	if err := c.Publish(msgs...); err != nil {
+		return fmt.Errorf("could not remove entities: %w", err)
+	}
+	state.Hash, state.Topics = "", nil
+	if err := state.save(); err != nil {
+		log.Warn().Err(err).Msg("Could not save MQTT discovery state.")
+	}
+	log.Info().Int("entities", len(msgs)).Msg("Removed agent entities from Home Assistant.")
+	return nil
+}
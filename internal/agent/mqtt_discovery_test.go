@@ -0,0 +1,127 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+)
+
+func Test_mqttDiscoveryHash(t *testing.T) {
+	a := mqttapi.NewMsg("homeassistant/button/go_hass_agent/a/config", []byte(`{"name":"a"}`))
+	b := mqttapi.NewMsg("homeassistant/button/go_hass_agent/b/config", []byte(`{"name":"b"}`))
+	changed := mqttapi.NewMsg("homeassistant/button/go_hass_agent/b/config", []byte(`{"name":"B"}`))
+
+	hash, topics := mqttDiscoveryHash([]*mqttapi.Msg{a, b})
+	wantTopics := []string{a.Topic, b.Topic}
+	if !reflect.DeepEqual(topics, wantTopics) {
+		t.Errorf("mqttDiscoveryHash() topics = %v, want %v", topics, wantTopics)
+	}
+
+	tests := []struct {
+		name     string
+		msgs     []*mqttapi.Msg
+		wantSame bool
+	}{
+		{name: "same configs", msgs: []*mqttapi.Msg{a, b}, wantSame: true},
+		{name: "different order", msgs: []*mqttapi.Msg{b, a}, wantSame: true},
+		{name: "changed config", msgs: []*mqttapi.Msg{a, changed}},
+		{name: "removed entity", msgs: []*mqttapi.Msg{a}},
+		{name: "no entities", msgs: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := mqttDiscoveryHash(tt.msgs)
+			if (got == hash) != tt.wantSame {
+				t.Errorf("mqttDiscoveryHash() = %v, original %v, wantSame %v", got, hash, tt.wantSame)
+			}
+		})
+	}
+}
+
+func Test_mqttDiscoveryState(t *testing.T) {
+	statePath := preferences.GetStatePath()
+	preferences.SetStatePath(t.TempDir())
+	t.Cleanup(func() { preferences.SetStatePath(statePath) })
+
+	// With no saved state, nothing has been published.
+	state, err := loadMQTTDiscoveryState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Hash != "" || state.Topics != nil {
+		t.Errorf("loadMQTTDiscoveryState() = %+v, want empty state", state)
+	}
+
+	state.Hash, state.Topics = "abc123", []string{"homeassistant/button/go_hass_agent/a/config"}
+	if err := state.save(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadMQTTDiscoveryState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash != state.Hash || !reflect.DeepEqual(got.Topics, state.Topics) {
+		t.Errorf("loadMQTTDiscoveryState() = %+v, want %+v", got, state)
+	}
+}
+
+func Test_publishMQTTDiscovery(t *testing.T) {
+	statePath := preferences.GetStatePath()
+	preferences.SetStatePath(t.TempDir())
+	t.Cleanup(func() { preferences.SetStatePath(statePath) })
+
+	newObj := func(ids ...string) *mqttObj {
+		o := &mqttObj{entities: make(map[string]*mqtthass.EntityConfig)}
+		for _, id := range ids {
+			o.entities[id] = mqtthass.NewEntityByID(id, mqttAppName).
+				AsButton().
+				WithDeviceInfo(&mqtthass.Device{})
+		}
+		return o
+	}
+	topic := func(id string) string {
+		return mqttapi.DiscoveryPrefix + "/button/" + mqttAppName + "/" + id + "/config"
+	}
+
+	client := &fakeMQTTClient{msgs: make(map[string]string)}
+	if err := publishMQTTDiscovery(newObj("a", "b"), client); err != nil {
+		t.Fatal(err)
+	}
+	if client.msgs[topic("a")] == "" || client.msgs[topic("b")] == "" {
+		t.Fatalf("publishMQTTDiscovery() published %v, want configs for a and b", client.msgs)
+	}
+
+	// Unchanged configs are still published, in case the broker lost them.
+	client.msgs = make(map[string]string)
+	if err := publishMQTTDiscovery(newObj("a", "b"), client); err != nil {
+		t.Fatal(err)
+	}
+	if client.msgs[topic("a")] == "" || client.msgs[topic("b")] == "" {
+		t.Errorf("publishMQTTDiscovery() published %v, want configs for a and b", client.msgs)
+	}
+
+	// Entities that no longer exist are removed.
+	client.msgs = make(map[string]string)
+	if err := publishMQTTDiscovery(newObj("a"), client); err != nil {
+		t.Fatal(err)
+	}
+	if config, ok := client.msgs[topic("b")]; !ok || config != "" {
+		t.Errorf("publishMQTTDiscovery() published %q for b, want empty config", config)
+	}
+	state, err := loadMQTTDiscoveryState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state.Topics, []string{topic("a")}) {
+		t.Errorf("publishMQTTDiscovery() saved topics %v, want %v", state.Topics, []string{topic("a")})
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+
+	"github.com/joshuar/go-hass-agent/internal/linux/power"
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+)
+
+const (
+	inhibitSleepID = "inhibit_sleep"
+
+	defaultInhibitWhat = "sleep:idle"
+	defaultInhibitWhy  = "Requested by Home Assistant"
+	defaultInhibitMode = "block"
+)
+
+// inhibitSwitch holds an inhibitor lock while it is on.
+type inhibitSwitch struct {
+	client mqtthass.MQTTClient
+	lock   *os.File
+	cfg    *mqtthass.EntityConfig
+	what   string
+	why    string
+	mode   string
+	mu     sync.Mutex
+}
+
+// addInhibitSwitch adds a switch entity to the object that, while on, holds a
+// systemd-logind inhibitor lock to keep the device from sleeping or going idle.
+// The actions inhibited, reason and mode can be set in the preferences.
+func addInhibitSwitch(ctx context.Context, o *mqttObj) {
+	prefs := preferences.FetchFromContext(ctx)
+	s := &inhibitSwitch{
+		what: prefs.MQTT.InhibitWhat,
+		why:  prefs.MQTT.InhibitWhy,
+		mode: prefs.MQTT.InhibitMode,
+	}
+	if s.what == "" {
+		s.what = defaultInhibitWhat
+	}
+	if s.why == "" {
+		s.why = defaultInhibitWhy
+	}
+	if s.mode == "" {
+		s.mode = defaultInhibitMode
+	}
+
+	s.cfg = newMQTTEntityConfig("switch", inhibitSleepID).
+		WithIcon("mdi:sleep-off").
+		WithCommandCallback(func(_ MQTT.Client, msg MQTT.Message) {
+			var err error
+			switch string(msg.Payload()) {
+			case switchOn:
+				err = s.inhibit(ctx)
+			case switchOff:
+				err = s.release()
+			}
+			if err != nil {
+				log.Warn().Err(err).Msg("Could not change inhibitor lock.")
+			}
+			s.publish()
+		})
+
+	o.entities[inhibitSleepID] = s.cfg
+	o.watchers = append(o.watchers, func(ctx context.Context, client mqtthass.MQTTClient) {
+		s.mu.Lock()
+		s.client = client
+		s.mu.Unlock()
+		s.publish()
+		// Release the lock when the agent stops.
+		<-ctx.Done()
+		if err := s.release(); err != nil {
+			log.Warn().Err(err).Msg("Could not release inhibitor lock.")
+		}
+	})
+}
+
+// inhibit takes the inhibitor lock, if it is not already held.
+func (s *inhibitSwitch) inhibit(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lock != nil {
+		return nil
+	}
+	lock, err := power.Inhibit(ctx, s.what, preferences.AppName, s.why, s.mode)
+	if err != nil {
+		return err
+	}
+	s.lock = lock
+	log.Info().Str("what", s.what).Str("mode", s.mode).Msg("Took inhibitor lock.")
+	return nil
+}
+
+// release releases the inhibitor lock, if it is held.
+func (s *inhibitSwitch) release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lock == nil {
+		return nil
+	}
+	err := s.lock.Close()
+	s.lock = nil
+	log.Info().Str("what", s.what).Msg("Released inhibitor lock.")
+	return err
+}
+
+// publish publishes whether the lock is held as the state of the switch.
+func (s *inhibitSwitch) publish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return
+	}
+	state := switchOff
+	if s.lock != nil {
+		state = switchOn
+	}
+	msg := mqttapi.NewMsg(s.cfg.Entity.StateTopic, []byte(state)).Retain()
+	if err := s.client.Publish(msg); err != nil {
+		log.Warn().Err(err).Msg("Could not publish inhibitor lock state.")
+	}
+}
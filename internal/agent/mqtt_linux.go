@@ -9,6 +9,8 @@ import (
 	"context"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"github.com/godbus/dbus/v5"
@@ -17,6 +19,8 @@ import (
 	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
 
 	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/linux/notifications"
+	"github.com/joshuar/go-hass-agent/internal/linux/power"
 	"github.com/joshuar/go-hass-agent/internal/preferences"
 	"github.com/joshuar/go-hass-agent/pkg/linux/dbusx"
 )
@@ -27,15 +31,19 @@ const (
 	dbusSessionUnlockMethod   = dbusSessionDest + ".Session.UnLock"
 	dbusSessionRebootMethod   = dbusSessionDest + ".Manager.Reboot"
 	dbusSessionPowerOffMethod = dbusSessionDest + ".Manager.PowerOff"
+	dbusManagerPath           = "/org/freedesktop/login1"
+	dbusManagerInterface      = dbusSessionDest + ".Manager"
 
 	dbusEmptyScreensaverMessage = ""
+
+	// sleepFuncTimeout is the longest that suspend is delayed while
+	// publishing that the agent is going offline.
+	sleepFuncTimeout = 3 * time.Second
 )
 
 func newMQTTObject(ctx context.Context) *mqttObj {
-	appName := "go_hass_agent"
-
 	baseEntity := func(entityID string) *mqtthass.EntityConfig {
-		return mqtthass.NewEntityByID(entityID, appName).
+		return mqtthass.NewEntityByID(entityID, mqttAppName).
 			AsButton().
 			WithDefaultOriginInfo().
 			WithDeviceInfo(mqttDevice())
@@ -60,6 +68,10 @@ func newMQTTObject(ctx context.Context) *mqttObj {
 
 	sessionPath := dbusx.GetSessionPath(ctx)
 	entities := make(map[string]*mqtthass.EntityConfig)
+	// destructive marks the entities that must be confirmed by the user before
+	// they are run, if confirmation is enabled in the preferences, and are
+	// subject to the cooldown.
+	destructive := make(map[string]bool)
 	entities["lock_screensaver"] = baseEntity("lock_screensaver").
 		WithIcon("mdi:eye-lock").
 		WithCommandCallback(func(_ MQTT.Client, _ MQTT.Message) {
@@ -76,6 +88,7 @@ func newMQTTObject(ctx context.Context) *mqttObj {
 				log.Warn().Err(err).Msg("Could not lock screensaver.")
 			}
 		})
+	destructive["lock_screensaver"] = true
 	entities["lock_session"] = baseEntity("lock_session").
 		WithIcon("mdi:eye-lock").
 		WithCommandCallback(func(_ MQTT.Client, _ MQTT.Message) {
@@ -84,6 +97,7 @@ func newMQTTObject(ctx context.Context) *mqttObj {
 				log.Warn().Err(err).Msg("Could not lock session.")
 			}
 		})
+	destructive["lock_session"] = true
 	entities["unlock_session"] = baseEntity("unlock_session").
 		WithIcon("mdi:eye-lock-open").
 		WithCommandCallback(func(_ MQTT.Client, _ MQTT.Message) {
@@ -100,6 +114,7 @@ func newMQTTObject(ctx context.Context) *mqttObj {
 				log.Warn().Err(err).Msg("Could not reboot session.")
 			}
 		})
+	destructive["reboot"] = true
 	entities["poweroff"] = baseEntity("poweroff").
 		WithIcon("mdi:power").
 		WithCommandCallback(func(_ MQTT.Client, _ MQTT.Message) {
@@ -108,9 +123,59 @@ func newMQTTObject(ctx context.Context) *mqttObj {
 				log.Warn().Err(err).Msg("Could not power off session.")
 			}
 		})
-	return &mqttObj{
-		entities: entities,
+	destructive["poweroff"] = true
+	// Only add the sleep actions that login1 reports the device supports (and
+	// the user can perform without authentication).
+	sleepActions := []struct {
+		id, method, icon string
+	}{
+		{id: "suspend", method: "Suspend", icon: "mdi:power-sleep"},
+		{id: "hibernate", method: "Hibernate", icon: "mdi:bed"},
+		{id: "hybrid_sleep", method: "HybridSleep", icon: "mdi:sleep"},
+		{id: "suspend_then_hibernate", method: "SuspendThenHibernate", icon: "mdi:bed-clock"},
+	}
+	for _, action := range sleepActions {
+		if !canPerformAction(ctx, action.method) {
+			log.Debug().Str("action", action.method).Msg("Power action not available.")
+			continue
+		}
+		method := dbusManagerInterface + "." + action.method
+		entities[action.id] = baseEntity(action.id).
+			WithIcon(action.icon).
+			WithCommandCallback(func(_ MQTT.Client, _ MQTT.Message) {
+				err := systemDbusCall(ctx, dbusManagerPath, dbusSessionDest, method, true)
+				if err != nil {
+					log.Warn().Err(err).Str("method", method).Msg("Could not perform power action.")
+				}
+			})
+		destructive[action.id] = true
 	}
+	o := &mqttObj{
+		entities:    entities,
+		extras:      make(map[string]*mqttEntity),
+		destructive: destructive,
+	}
+	addPowerProfileSelect(ctx, o)
+	addBacklightNumbers(ctx, o)
+	addMediaControls(ctx, o)
+	addInhibitSwitch(ctx, o)
+	addUnitControls(ctx, o)
+	addMQTTCommands(ctx, o)
+	addMQTTCommandGuard(ctx, o, notifications.Confirm)
+	return o
+}
+
+// canPerformAction returns whether login1 reports that the given power action
+// (e.g., Suspend) can be performed. It calls the corresponding Can* method
+// (e.g., CanSuspend), which returns "yes" if the action is supported and the
+// user can perform it without authentication.
+func canPerformAction(ctx context.Context, action string) bool {
+	result := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Path(dbusManagerPath).
+		Destination(dbusSessionDest).
+		GetData(dbusManagerInterface + ".Can" + action).
+		AsRawInterface()
+	return result == "yes"
 }
 
 func mqttDevice() *mqtthass.Device {
@@ -125,6 +190,85 @@ func mqttDevice() *mqtthass.Device {
 	}
 }
 
+// mqttAvailabilityTopic returns the topic on which the availability of the
+// agent is published. It is unique to the device.
+var mqttAvailabilityTopic = sync.OnceValue(func() string {
+	dev := linux.NewDevice(preferences.AppName, preferences.AppVersion)
+	return mqttAppName + "/" + dev.DeviceID() + "/availability"
+})
+
+// watchSleep will call the given function with true just before the device
+// suspends and false after it resumes. A sleep delay inhibitor lock is held
+// while the device is awake, so that suspend waits (for up to
+// sleepFuncTimeout) for the function to return before the device sleeps.
+func watchSleep(ctx context.Context, sleepFunc func(sleeping bool)) error {
+	var mu sync.Mutex
+	var lock *os.File
+	takeLock := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if lock != nil || ctx.Err() != nil {
+			return
+		}
+		l, err := power.Inhibit(ctx, "sleep", preferences.AppName, "Publishing availability before suspend", "delay")
+		if err != nil {
+			log.Debug().Err(err).Msg("Could not take sleep delay lock. Availability may not be published before suspend.")
+			return
+		}
+		lock = l
+	}
+	releaseLock := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if lock != nil {
+			lock.Close()
+			lock = nil
+		}
+	}
+
+	takeLock()
+	err := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Match([]dbus.MatchOption{
+			dbus.WithMatchObjectPath("/org/freedesktop/login1"),
+			dbus.WithMatchInterface("org.freedesktop.login1.Manager"),
+		}).
+		Handler(func(s *dbus.Signal) {
+			if s.Name != "org.freedesktop.login1.Manager.PrepareForSleep" || len(s.Body) == 0 {
+				return
+			}
+			sleeping, ok := s.Body[0].(bool)
+			if !ok {
+				return
+			}
+			if !sleeping {
+				sleepFunc(false)
+				takeLock()
+				return
+			}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				sleepFunc(true)
+			}()
+			select {
+			case <-done:
+			case <-time.After(sleepFuncTimeout):
+				log.Debug().Msg("Timed out waiting to publish availability before suspend.")
+			}
+			releaseLock()
+		}).
+		AddWatch(ctx)
+	if err != nil {
+		releaseLock()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		releaseLock()
+	}()
+	return nil
+}
+
 func GetDesktopEnvScreensaverConfig() (string, string, *string) {
 	desktop := os.Getenv("XDG_CURRENT_DESKTOP")
 	switch {
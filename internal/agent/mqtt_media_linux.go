@@ -0,0 +1,109 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+
+	"github.com/joshuar/go-hass-agent/internal/linux/media"
+)
+
+const (
+	mediaVolumeID   = "media_volume"
+	mediaPositionID = "media_position"
+
+	// mediaPositionMax is the largest position (in seconds) that can be set
+	// from Home Assistant. The range of a number entity cannot change with each
+	// track, so it is large enough for any track.
+	mediaPositionMax = 24 * 60 * 60
+)
+
+// addMediaControls adds entities to the object for controlling the most
+// recently active MPRIS media player: buttons for play/pause, next and previous
+// track and numbers for the volume and seeking within the current track.
+func addMediaControls(ctx context.Context, o *mqttObj) {
+	monitor, err := media.MonitorFromContext(ctx)
+	if err != nil {
+		log.Debug().Err(err).Msg("Could not monitor media players. Will not add media controls.")
+		return
+	}
+
+	buttons := []struct {
+		action func(context.Context) error
+		id     string
+		icon   string
+	}{
+		{id: "media_play_pause", icon: "mdi:play-pause", action: monitor.PlayPause},
+		{id: "media_next", icon: "mdi:skip-next", action: monitor.Next},
+		{id: "media_previous", icon: "mdi:skip-previous", action: monitor.Previous},
+	}
+	for _, button := range buttons {
+		o.entities[button.id] = mqtthass.NewEntityByID(button.id, mqttAppName).
+			AsButton().
+			WithDefaultOriginInfo().
+			WithDeviceInfo(mqttDevice()).
+			WithIcon(button.icon).
+			WithCommandCallback(func(_ MQTT.Client, _ MQTT.Message) {
+				if err := button.action(ctx); err != nil {
+					log.Warn().Err(err).Str("control", button.id).Msg("Could not control media player.")
+				}
+			})
+	}
+
+	volume := newMQTTEntityConfig("number", mediaVolumeID).
+		WithIcon("mdi:volume-high").
+		WithUnits("%").
+		WithCommandCallback(func(_ MQTT.Client, msg MQTT.Message) {
+			percent, err := strconv.ParseFloat(string(msg.Payload()), 64)
+			if err != nil {
+				log.Warn().Err(err).Msg("Invalid media volume.")
+				return
+			}
+			if err := monitor.SetVolume(ctx, percent/100); err != nil {
+				log.Warn().Err(err).Msg("Could not set media volume.")
+			}
+		})
+	o.entities[mediaVolumeID] = volume
+	o.extras[mediaVolumeID] = newNumberExtras(0, 100)
+
+	position := newMQTTEntityConfig("number", mediaPositionID).
+		WithIcon("mdi:timer-music").
+		WithUnits("s").
+		WithCommandCallback(func(_ MQTT.Client, msg MQTT.Message) {
+			seconds, err := strconv.ParseFloat(string(msg.Payload()), 64)
+			if err != nil {
+				log.Warn().Err(err).Msg("Invalid media position.")
+				return
+			}
+			if err := monitor.SetPosition(ctx, time.Duration(seconds*float64(time.Second))); err != nil {
+				log.Warn().Err(err).Msg("Could not seek media player.")
+			}
+		})
+	o.entities[mediaPositionID] = position
+	o.extras[mediaPositionID] = newNumberExtras(0, mediaPositionMax)
+	o.extras[mediaPositionID].Mode = "box"
+
+	volumePublisher := newNumberPublisher(volume)
+	positionPublisher := newNumberPublisher(position)
+	o.watchers = append(o.watchers, func(_ context.Context, client mqtthass.MQTTClient) {
+		volumePublisher.setClient(client)
+		positionPublisher.setClient(client)
+		// The monitor sends the current state of the active player first, so
+		// the latest state will be published once the watcher starts.
+		for state := range monitor.Updates() {
+			volumePublisher.publish(int(math.Round(state.Volume * 100)))
+			positionPublisher.publish(int(state.Position.Seconds()))
+		}
+	})
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+
+	"github.com/joshuar/go-hass-agent/internal/linux/power"
+)
+
+const powerProfileID = "power_profile"
+
+// addPowerProfileSelect adds a select entity to the object for choosing the
+// active power profile of power-profiles-daemon. The entity is not added if
+// the daemon is not available.
+func addPowerProfileSelect(ctx context.Context, o *mqttObj) {
+	profiles, err := power.PowerProfiles(ctx)
+	if err != nil || len(profiles) == 0 {
+		log.Debug().Err(err).Msg("No power profiles available. Will not add power profile control.")
+		return
+	}
+
+	cfg := newMQTTEntityConfig("select", powerProfileID).
+		WithIcon("mdi:flash").
+		WithCommandCallback(func(_ MQTT.Client, msg MQTT.Message) {
+			profile := string(msg.Payload())
+			if !slices.Contains(profiles, profile) {
+				log.Warn().Str("profile", profile).Msg("Unknown power profile.")
+				return
+			}
+			if err := power.SetPowerProfile(ctx, profile); err != nil {
+				log.Warn().Err(err).Str("profile", profile).Msg("Could not set power profile.")
+			}
+		})
+
+	o.entities[powerProfileID] = cfg
+	o.extras[powerProfileID] = &mqttEntity{Options: profiles}
+	o.watchers = append(o.watchers, func(ctx context.Context, client mqtthass.MQTTClient) {
+		// The power profile sensor sends the current profile and then any
+		// changes to it.
+		for s := range power.PowerProfileUpdater(ctx) {
+			msg := mqttapi.NewMsg(cfg.Entity.StateTopic, []byte(fmt.Sprintf("%v", s.State()))).Retain()
+			if err := client.Publish(msg); err != nil {
+				log.Warn().Err(err).Msg("Could not publish power profile.")
+			}
+		}
+	})
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+)
+
+const (
+	lastCommandID = "last_command"
+
+	// defaultConfirmTimeout is how long the user has to confirm an action if
+	// no timeout is set in the preferences.
+	defaultConfirmTimeout = 30 * time.Second
+
+	mqttAuditLogFile = "mqtt-audit.log"
+)
+
+// The outcomes of a command received over MQTT, as recorded in the audit log.
+const (
+	outcomeAccepted     = "accepted"
+	outcomeConfirmed    = "confirmed"
+	outcomeDenied       = "denied"
+	outcomeDisabled     = "disabled"
+	outcomeCooldown     = "cooldown"
+	outcomePending      = "awaiting confirmation"
+	outcomeConfirmError = "confirmation failed"
+)
+
+// confirmFunc asks the user to confirm an action, returning whether they did
+// before the timeout.
+type confirmFunc func(ctx context.Context, summary, body string, timeout time.Duration) (bool, error)
+
+// mqttAuditRecord is an entry in the audit log of commands received over MQTT.
+type mqttAuditRecord struct {
+	Time    time.Time `json:"time"`
+	Entity  string    `json:"entity"`
+	Payload string    `json:"payload"`
+	Outcome string    `json:"outcome"`
+}
+
+// mqttCommandGuard checks every command received over MQTT before it is acted
+// on. Commands for disabled controls are ignored, buttons for destructive
+// actions and user-defined commands cannot be pressed again within a cooldown
+// period and some controls must be confirmed by the user on the device. Every
+// command received, and its outcome, is appended to an audit log and reported
+// by a diagnostic sensor.
+type mqttCommandGuard struct {
+	ctx            context.Context
+	client         mqtthass.MQTTClient
+	confirm        confirmFunc
+	sensor         *mqtthass.EntityConfig
+	lastRun        map[string]time.Time
+	pending        map[string]bool
+	auditPath      string
+	disabled       []string
+	confirmIDs     []string
+	cooldownIDs    []string
+	cooldown       time.Duration
+	confirmTimeout time.Duration
+	mu             sync.Mutex
+}
+
+// newMQTTCommandGuard creates a guard using the preferences in the context.
+// The given function is used to ask the user for confirmation. If it is nil,
+// any control that must be confirmed will not run. The controls marked in
+// destructive are subject to the cooldown and must be confirmed if confirmation
+// is enabled in the preferences.
+func newMQTTCommandGuard(ctx context.Context, confirm confirmFunc, destructive map[string]bool) *mqttCommandGuard {
+	prefs := preferences.FetchFromContext(ctx)
+	g := &mqttCommandGuard{
+		ctx:            ctx,
+		confirm:        confirm,
+		lastRun:        make(map[string]time.Time),
+		pending:        make(map[string]bool),
+		auditPath:      filepath.Join(preferences.GetStatePath(), mqttAuditLogFile),
+		disabled:       prefs.MQTT.Disabled,
+		cooldown:       time.Duration(prefs.MQTT.Cooldown) * time.Second,
+		confirmTimeout: time.Duration(prefs.MQTT.ConfirmTimeout) * time.Second,
+	}
+	if g.confirmTimeout == 0 {
+		g.confirmTimeout = defaultConfirmTimeout
+	}
+	for id, isDestructive := range destructive {
+		if !isDestructive {
+			continue
+		}
+		g.cooldownIDs = append(g.cooldownIDs, id)
+		if prefs.MQTT.Confirm {
+			g.confirmIDs = append(g.confirmIDs, id)
+		}
+	}
+	for _, command := range prefs.MQTT.Commands {
+		g.cooldownIDs = append(g.cooldownIDs, command.ID())
+		if command.Confirm {
+			g.confirmIDs = append(g.confirmIDs, command.ID())
+		}
+	}
+
+	g.sensor = newMQTTEntityConfig("sensor", lastCommandID).
+		WithIcon("mdi:console")
+	g.sensor.Entity.CommandTopic = ""
+	g.sensor.Entity.EntityCategory = "diagnostic"
+	g.sensor.Entity.AttributesTopic = strings.TrimSuffix(g.sensor.ConfigTopic, "/config") + "/attributes"
+	return g
+}
+
+// addMQTTCommandGuard adds a guard to the object, along with its sensor, and
+// removes any disabled controls from the object.
+func addMQTTCommandGuard(ctx context.Context, o *mqttObj, confirm confirmFunc) {
+	g := newMQTTCommandGuard(ctx, confirm, o.destructive)
+	for id := range o.entities {
+		if !g.enabled(id) {
+			log.Debug().Str("control", id).Msg("Control disabled.")
+			delete(o.entities, id)
+			delete(o.extras, id)
+		}
+	}
+	o.guard = g
+	o.entities[lastCommandID] = g.sensor
+	o.watchers = append(o.watchers, g.watch)
+}
+
+// enabled returns whether the control with the given ID is enabled.
+func (g *mqttCommandGuard) enabled(id string) bool {
+	return !slices.Contains(g.disabled, id)
+}
+
+// hasCooldown returns whether the control with the given ID, if it is a
+// button, cannot be pressed again within the cooldown period. This applies to
+// destructive actions and to user-defined commands, including those provided
+// by scripts.
+func (g *mqttCommandGuard) hasCooldown(id string) bool {
+	return slices.Contains(g.cooldownIDs, id) || strings.HasPrefix(id, scriptCommandPrefix)
+}
+
+// watch sets the client used to publish the state of the sensor.
+func (g *mqttCommandGuard) watch(_ context.Context, client mqtthass.MQTTClient) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.client = client
+}
+
+// wrap returns a callback for the given control that checks a command before
+// passing it to the given callback.
+func (g *mqttCommandGuard) wrap(id string, cfg *mqtthass.EntityConfig, callback func(MQTT.Client, MQTT.Message)) func(MQTT.Client, MQTT.Message) {
+	isButton := strings.HasPrefix(cfg.ConfigTopic, mqttapi.DiscoveryPrefix+"/button/")
+	return func(client MQTT.Client, msg MQTT.Message) {
+		payload := string(msg.Payload())
+		outcome, needsConfirm := g.check(id, isButton)
+		if outcome != "" {
+			g.record(id, payload, outcome)
+			return
+		}
+		if !needsConfirm {
+			g.record(id, payload, outcomeAccepted)
+			callback(client, msg)
+			return
+		}
+		// Wait for confirmation in the background so other MQTT messages are
+		// not held up.
+		go func() {
+			defer g.done(id)
+			confirmed, err := g.ask(cfg.Entity.Name)
+			switch {
+			case err != nil:
+				log.Warn().Err(err).Str("control", id).Msg("Could not ask for confirmation.")
+				g.record(id, payload, outcomeConfirmError)
+			case confirmed:
+				g.record(id, payload, outcomeConfirmed)
+				callback(client, msg)
+			default:
+				g.record(id, payload, outcomeDenied)
+			}
+		}()
+	}
+}
+
+// check returns the outcome if the command for the given control should not
+// be acted on. Otherwise, it returns whether the command must be confirmed.
+func (g *mqttCommandGuard) check(id string, isButton bool) (string, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch {
+	case !g.enabled(id):
+		return outcomeDisabled, false
+	case g.pending[id]:
+		return outcomePending, false
+	case isButton && g.hasCooldown(id) && time.Since(g.lastRun[id]) < g.cooldown:
+		return outcomeCooldown, false
+	}
+	g.lastRun[id] = time.Now()
+	needsConfirm := slices.Contains(g.confirmIDs, id)
+	if needsConfirm {
+		g.pending[id] = true
+	}
+	return "", needsConfirm
+}
+
+// done marks that a control is no longer awaiting confirmation.
+func (g *mqttCommandGuard) done(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.pending, id)
+}
+
+// ask asks the user to confirm running the control with the given name.
+func (g *mqttCommandGuard) ask(name string) (bool, error) {
+	if g.confirm == nil {
+		return false, errors.New("confirmation not supported")
+	}
+	return g.confirm(g.ctx,
+		"Home Assistant: "+name,
+		fmt.Sprintf("Home Assistant wants to run %q on this device. Allow it?", name),
+		g.confirmTimeout)
+}
+
+// record appends the command and its outcome to the audit log and publishes it
+// as the state of the sensor.
+func (g *mqttCommandGuard) record(id, payload, outcome string) {
+	record := &mqttAuditRecord{
+		Time:    time.Now(),
+		Entity:  id,
+		Payload: payload,
+		Outcome: outcome,
+	}
+	log.Info().Str("control", id).Str("payload", payload).Str("outcome", outcome).
+		Msg("Received MQTT command.")
+
+	entry, err := json.Marshal(record)
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not marshal MQTT audit record.")
+		return
+	}
+	if err := appendAuditLog(g.auditPath, entry); err != nil {
+		log.Warn().Err(err).Msg("Could not write MQTT audit log.")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.client == nil {
+		return
+	}
+	msgs := []*mqttapi.Msg{
+		mqttapi.NewMsg(g.sensor.Entity.StateTopic, []byte(id)).Retain(),
+		mqttapi.NewMsg(g.sensor.Entity.AttributesTopic, entry).Retain(),
+	}
+	if err := g.client.Publish(msgs...); err != nil {
+		log.Warn().Err(err).Msg("Could not publish last MQTT command.")
+	}
+}
+
+// appendAuditLog appends the given entry as a line to the audit log at the
+// given path. The log is append-only; existing entries are never changed or
+// removed.
+func appendAuditLog(path string, entry []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(entry, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+)
+
+// fakeMessage is a received MQTT message with the given payload.
+type fakeMessage []byte
+
+func (m fakeMessage) Duplicate() bool   { return false }
+func (m fakeMessage) Qos() byte         { return 0 }
+func (m fakeMessage) Retained() bool    { return false }
+func (m fakeMessage) Topic() string     { return "" }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return m }
+func (m fakeMessage) Ack()              {}
+
+func Test_mqttCommandGuard_wrap(t *testing.T) {
+	button := mqtthass.NewEntityByID("reboot", mqttAppName).AsButton()
+	mediaButton := mqtthass.NewEntityByID("media_next", mqttAppName).AsButton()
+	scriptButton := mqtthass.NewEntityByID(scriptCommandPrefix+"backup", mqttAppName).AsButton()
+	number := newMQTTEntityConfig("number", "screen_brightness")
+
+	confirmWith := func(confirmed bool) confirmFunc {
+		return func(_ context.Context, _, _ string, _ time.Duration) (bool, error) {
+			return confirmed, nil
+		}
+	}
+
+	tests := []struct {
+		confirm      confirmFunc
+		cfg          *mqtthass.EntityConfig
+		name         string
+		id           string
+		disabled     []string
+		confirmIDs   []string
+		cooldownIDs  []string
+		wantOutcomes []string
+		presses      int
+		wantCalls    int32
+		cooldown     time.Duration
+	}{
+		{
+			name:         "accepted",
+			id:           "reboot",
+			cfg:          button,
+			presses:      1,
+			wantCalls:    1,
+			wantOutcomes: []string{outcomeAccepted},
+		},
+		{
+			name:         "disabled",
+			id:           "reboot",
+			cfg:          button,
+			disabled:     []string{"reboot"},
+			presses:      1,
+			wantCalls:    0,
+			wantOutcomes: []string{outcomeDisabled},
+		},
+		{
+			name:         "button cooldown",
+			id:           "reboot",
+			cfg:          button,
+			cooldownIDs:  []string{"reboot"},
+			cooldown:     time.Minute,
+			presses:      2,
+			wantCalls:    1,
+			wantOutcomes: []string{outcomeAccepted, outcomeCooldown},
+		},
+		{
+			name:         "script command cooldown",
+			id:           scriptCommandPrefix + "backup",
+			cfg:          scriptButton,
+			cooldown:     time.Minute,
+			presses:      2,
+			wantCalls:    1,
+			wantOutcomes: []string{outcomeAccepted, outcomeCooldown},
+		},
+		{
+			name:         "no cooldown for other buttons",
+			id:           "media_next",
+			cfg:          mediaButton,
+			cooldownIDs:  []string{"reboot"},
+			cooldown:     time.Minute,
+			presses:      2,
+			wantCalls:    2,
+			wantOutcomes: []string{outcomeAccepted, outcomeAccepted},
+		},
+		{
+			name:         "no cooldown for numbers",
+			id:           "screen_brightness",
+			cfg:          number,
+			cooldownIDs:  []string{"screen_brightness"},
+			cooldown:     time.Minute,
+			presses:      2,
+			wantCalls:    2,
+			wantOutcomes: []string{outcomeAccepted, outcomeAccepted},
+		},
+		{
+			name:         "confirmed",
+			id:           "reboot",
+			cfg:          button,
+			confirmIDs:   []string{"reboot"},
+			confirm:      confirmWith(true),
+			presses:      1,
+			wantCalls:    1,
+			wantOutcomes: []string{outcomeConfirmed},
+		},
+		{
+			name:         "denied",
+			id:           "reboot",
+			cfg:          button,
+			confirmIDs:   []string{"reboot"},
+			confirm:      confirmWith(false),
+			presses:      1,
+			wantCalls:    0,
+			wantOutcomes: []string{outcomeDenied},
+		},
+		{
+			name:         "confirmation unsupported",
+			id:           "reboot",
+			cfg:          button,
+			confirmIDs:   []string{"reboot"},
+			presses:      1,
+			wantCalls:    0,
+			wantOutcomes: []string{outcomeConfirmError},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditPath := filepath.Join(t.TempDir(), mqttAuditLogFile)
+			g := &mqttCommandGuard{
+				ctx:            context.Background(),
+				confirm:        tt.confirm,
+				lastRun:        make(map[string]time.Time),
+				pending:        make(map[string]bool),
+				auditPath:      auditPath,
+				disabled:       tt.disabled,
+				confirmIDs:     tt.confirmIDs,
+				cooldownIDs:    tt.cooldownIDs,
+				cooldown:       tt.cooldown,
+				confirmTimeout: time.Second,
+			}
+			var calls atomic.Int32
+			callback := g.wrap(tt.id, tt.cfg, func(_ MQTT.Client, _ MQTT.Message) {
+				calls.Add(1)
+			})
+			for range tt.presses {
+				callback(nil, fakeMessage("PRESS"))
+			}
+
+			// Confirmation happens in the background, so wait for every
+			// press to be recorded and acted on.
+			var outcomes []string
+			assert.Eventually(t, func() bool {
+				outcomes = readAuditOutcomes(t, auditPath)
+				return len(outcomes) == len(tt.wantOutcomes) && calls.Load() == tt.wantCalls
+			}, time.Second, 10*time.Millisecond)
+			assert.Equal(t, tt.wantOutcomes, outcomes)
+			assert.Equal(t, tt.wantCalls, calls.Load())
+		})
+	}
+}
+
+// readAuditOutcomes returns the outcomes recorded in the audit log at the given
+// path.
+func readAuditOutcomes(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var outcomes []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record mqttAuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Error(err)
+			continue
+		}
+		outcomes = append(outcomes, record.Outcome)
+	}
+	return outcomes
+}
+
+func Test_appendAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), mqttAuditLogFile)
+	if err := os.WriteFile(path, []byte("existing\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	entry := bytes.Repeat([]byte{'x'}, 512*1024)
+
+	// Entries are always appended, however large the log grows, and existing
+	// entries are kept.
+	for range 3 {
+		if err := appendAuditLog(path, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "existing", lines[0])
+	for _, line := range lines[1:] {
+		assert.Equal(t, string(entry), line)
+	}
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, matches)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+
+	"github.com/joshuar/go-hass-agent/internal/scripts"
+)
+
+// scriptCommandPrefix is the prefix of the IDs of script command buttons.
+const scriptCommandPrefix = "script_"
+
+// scriptCommandButton tracks a script command that has been published as a
+// button over MQTT.
+type scriptCommandButton struct {
+	cmd scripts.Command
+	obj *mqttObj
+}
+
+// newScriptCommandButton creates a button entity that will run the given
+// script command when pressed. Presses are checked by the given guard, if it is
+// not nil.
+func newScriptCommandButton(runner *scripts.Runner, cmd *scripts.Command, guard *mqttCommandGuard) *scriptCommandButton {
+	id := scriptCommandPrefix + cmd.ID
+	entity := mqtthass.NewEntityByID(id, mqttAppName).
+		AsButton().
+		WithIcon(cmd.Icon).
+		WithDefaultOriginInfo().
+		WithDeviceInfo(mqttDevice()).
+		WithCommandCallback(func(_ MQTT.Client, _ MQTT.Message) {
+			// Run the script in the background so other MQTT messages are
+			// not held up while it runs.
+			go func() {
+				if err := runner.RunCommand(cmd.ID); err != nil {
+					log.Warn().Err(err).Msg("Could not run script command.")
+				}
+			}()
+		})
+	entity.Entity.Name = cmd.Name
+	return &scriptCommandButton{
+		cmd: *cmd,
+		obj: &mqttObj{
+			entities: map[string]*mqtthass.EntityConfig{id: entity},
+			guard:    guard,
+		},
+	}
+}
+
+// runScriptCommands publishes the commands provided by scripts as buttons over
+// MQTT. As scripts are added, changed or removed, the buttons are updated. Any
+// buttons disabled by the given guard are not published. The buttons are
+// published again whenever a value is received on the given reconnected
+// channel. It blocks until the context is cancelled.
+func runScriptCommands(ctx context.Context, runner *scripts.Runner, client mqtthass.MQTTClient, guard *mqttCommandGuard, reconnected <-chan struct{}) {
+	buttons := make(map[string]*scriptCommandButton)
+
+	update := func() {
+		current := make(map[string]*scripts.Command)
+		for _, cmd := range runner.Commands() {
+			if guard != nil && !guard.enabled(scriptCommandPrefix+cmd.ID) {
+				continue
+			}
+			current[cmd.ID] = cmd
+		}
+		for id, button := range buttons {
+			if _, ok := current[id]; !ok {
+				if err := mqtthass.UnRegister(button.obj, client); err != nil {
+					log.Warn().Err(err).Str("command", id).
+						Msg("Could not remove script command button.")
+				}
+				delete(buttons, id)
+			}
+		}
+		for id, cmd := range current {
+			if existing, ok := buttons[id]; ok && existing.cmd == *cmd {
+				continue
+			}
+			button := newScriptCommandButton(runner, cmd, guard)
+			if err := mqtthass.Register(button.obj, client); err != nil {
+				log.Warn().Err(err).Str("command", id).
+					Msg("Could not add script command button.")
+				continue
+			}
+			if err := mqtthass.Subscribe(button.obj, client); err != nil {
+				log.Warn().Err(err).Str("command", id).
+					Msg("Could not subscribe to script command button.")
+				continue
+			}
+			buttons[id] = button
+			log.Debug().Str("command", id).Msg("Added script command button.")
+		}
+	}
+
+	update()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-runner.CommandsChanged():
+			update()
+		case <-reconnected:
+			for id, button := range buttons {
+				if err := mqtthass.Register(button.obj, client); err != nil {
+					log.Warn().Err(err).Str("command", id).
+						Msg("Could not publish script command button.")
+				}
+			}
+		}
+	}
+}
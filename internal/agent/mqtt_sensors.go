@@ -0,0 +1,181 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	mqttclient "github.com/joshuar/go-hass-agent/internal/mqtt"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+// mqttSensorPublisher publishes sensors as MQTT discovery entities, under the
+// same device as the MQTT controls. It satisfies the tracker.Publisher
+// interface.
+type mqttSensorPublisher struct {
+	client  mqtthass.MQTTClient
+	device  *mqtthass.Device
+	configs map[string][]byte
+	mu      sync.Mutex
+}
+
+func newMQTTSensorPublisher(client mqtthass.MQTTClient) *mqttSensorPublisher {
+	return &mqttSensorPublisher{
+		client:  client,
+		device:  mqttDevice(),
+		configs: make(map[string][]byte),
+	}
+}
+
+// forget forgets the discovery configs published, so that they are published
+// again with the next update of each sensor.
+func (p *mqttSensorPublisher) forget() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.configs = make(map[string][]byte)
+}
+
+// PublishSensor publishes the state and attributes of the given sensor. The
+// discovery config for the sensor is published first if it has not been
+// published before or has changed.
+func (p *mqttSensorPublisher) PublishSensor(_ context.Context, s tracker.Sensor) error {
+	cfg := newMQTTSensorConfig(s, p.device)
+	entity := newMQTTEntity(cfg.Entity)
+	if d, ok := s.(tracker.DisabledByDefault); ok && d.DisabledByDefault() {
+		enabled := false
+		entity.EnabledByDefault = &enabled
+	}
+	// Sensors that can become unavailable have their own availability topic.
+	// They are only available while both they and the agent are.
+	a, hasAvailability := s.(tracker.Availability)
+	availabilityTopic := strings.TrimSuffix(cfg.ConfigTopic, "/config") + "/availability"
+	if hasAvailability {
+		entity.Availability = []mqttAvailability{{Topic: entity.AvailabilityTopic}, {Topic: availabilityTopic}}
+		entity.AvailabilityMode = "all"
+		entity.AvailabilityTopic = ""
+	}
+	config, err := json.Marshal(entity)
+	if err != nil {
+		return fmt.Errorf("could not marshal config: %w", err)
+	}
+
+	var msgs []*mqttapi.Msg
+	p.mu.Lock()
+	configChanged := !bytes.Equal(p.configs[s.ID()], config)
+	p.mu.Unlock()
+	if configChanged {
+		msgs = append(msgs, mqttapi.NewMsg(cfg.ConfigTopic, config).Retain())
+	}
+	available := !hasAvailability || a.Available()
+	if hasAvailability {
+		payload := mqttclient.PayloadOffline
+		if available {
+			payload = mqttclient.PayloadOnline
+		}
+		msgs = append(msgs, mqttapi.NewMsg(availabilityTopic, []byte(payload)).Retain())
+	}
+	// The last state of an unavailable sensor is kept.
+	if available {
+		state, err := mqttSensorState(s)
+		if err != nil {
+			return fmt.Errorf("could not marshal state: %w", err)
+		}
+		msgs = append(msgs, mqttapi.NewMsg(cfg.Entity.StateTopic, state).Retain())
+		if cfg.Entity.AttributesTopic != "" {
+			attributes, err := json.Marshal(s.Attributes())
+			if err != nil {
+				return fmt.Errorf("could not marshal attributes: %w", err)
+			}
+			msgs = append(msgs, mqttapi.NewMsg(cfg.Entity.AttributesTopic, attributes).Retain())
+		}
+	}
+
+	if err := p.client.Publish(msgs...); err != nil {
+		return err
+	}
+	if configChanged {
+		p.mu.Lock()
+		p.configs[s.ID()] = config
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// newMQTTSensorConfig creates the MQTT entity config representing the given
+// sensor.
+func newMQTTSensorConfig(s tracker.Sensor, device *mqtthass.Device) *mqtthass.EntityConfig {
+	cfg := mqtthass.NewEntityByID(s.ID(), mqttAppName)
+	if s.SensorType() == sensor.TypeBinary {
+		cfg.AsBinarySensor()
+	} else {
+		cfg.AsSensor()
+	}
+	cfg.WithDefaultOriginInfo().
+		WithDeviceInfo(device).
+		WithValueTemplate("{{ value }}").
+		WithIcon(s.Icon()).
+		WithUnits(s.Units())
+	if s.DeviceClass() != 0 {
+		cfg.WithDeviceClass(mqttDeviceClass(s.DeviceClass()))
+	}
+	if s.StateClass() != 0 {
+		cfg.Entity.StateClass = s.StateClass().String()
+	}
+	if s.Attributes() != nil {
+		cfg.WithAttributesTopic()
+	}
+	cfg.Entity.Name = s.Name()
+	cfg.Entity.EntityCategory = s.Category()
+	return cfg
+}
+
+// mqttSensorState formats the state of the given sensor as an MQTT payload.
+// Binary sensors use the default ON/OFF payloads of Home Assistant and a nil
+// state is sent as "None", which Home Assistant treats as unknown. States that
+// are not scalar values (e.g., maps or slices) are encoded as JSON.
+func mqttSensorState(s tracker.Sensor) (json.RawMessage, error) {
+	state := s.State()
+	if b, ok := state.(bool); ok && s.SensorType() == sensor.TypeBinary {
+		if b {
+			return json.RawMessage("ON"), nil
+		}
+		return json.RawMessage("OFF"), nil
+	}
+	if state == nil {
+		return json.RawMessage("None"), nil
+	}
+	switch reflect.ValueOf(state).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+		return json.Marshal(state)
+	default:
+		return json.RawMessage(fmt.Sprintf("%v", state)), nil
+	}
+}
+
+// mqttDeviceClass converts the device class to the format expected by Home
+// Assistant (e.g., Data_size becomes data_size and EnergyStorage becomes
+// energy_storage).
+func mqttDeviceClass(d sensor.SensorDeviceClass) string {
+	var b strings.Builder
+	for i, r := range d.String() {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteRune('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return strings.ReplaceAll(b.String(), "__", "_")
+}
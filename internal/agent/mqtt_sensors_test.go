@@ -0,0 +1,128 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	"github.com/joshuar/go-hass-agent/internal/linux"
+)
+
+func Test_mqttDeviceClass(t *testing.T) {
+	tests := []struct {
+		name  string
+		class sensor.SensorDeviceClass
+		want  string
+	}{
+		{name: "snake case class", class: sensor.Data_size, want: "data_size"},
+		{name: "camel case class", class: sensor.EnergyStorage, want: "energy_storage"},
+		{name: "prefixed class", class: sensor.SensorBattery, want: "battery"},
+		{name: "class with number", class: sensor.Pm25, want: "pm25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mqttDeviceClass(tt.class); got != tt.want {
+				t.Errorf("mqttDeviceClass() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mqttSensorState(t *testing.T) {
+	tests := []struct {
+		value  any
+		name   string
+		want   string
+		binary bool
+	}{
+		{name: "binary on", value: true, binary: true, want: "ON"},
+		{name: "binary off", value: false, binary: true, want: "OFF"},
+		{name: "nil", value: nil, want: "None"},
+		{name: "number", value: 4.2, want: "4.2"},
+		{name: "string", value: "active", want: "active"},
+		{name: "map", value: map[string]int{"a": 1}, want: `{"a":1}`},
+		{name: "slice", value: []string{"x", "y"}, want: `["x","y"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &linux.Sensor{Value: tt.value, IsBinary: tt.binary}
+			got, err := mqttSensorState(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+// fakeMQTTClient records the messages published.
+type fakeMQTTClient struct {
+	msgs map[string]string
+}
+
+func (c *fakeMQTTClient) Publish(msgs ...*mqttapi.Msg) error {
+	for _, msg := range msgs {
+		c.msgs[msg.Topic] = string(msg.Message)
+	}
+	return nil
+}
+
+func (c *fakeMQTTClient) Subscribe(_ ...*mqttapi.Subscription) error {
+	return nil
+}
+
+// availabilitySensor is a sensor that can become unavailable.
+type availabilitySensor struct {
+	linux.Sensor
+	available bool
+}
+
+func (s *availabilitySensor) Available() bool {
+	return s.available
+}
+
+func Test_mqttSensorPublisher_PublishSensor(t *testing.T) {
+	const prefix = mqttapi.DiscoveryPrefix + "/sensor/" + mqttAppName + "/usage"
+
+	s := &availabilitySensor{available: true}
+	s.SensorTypeValue = linux.SensorDiskUsage
+	s.Value = 42
+	client := &fakeMQTTClient{msgs: make(map[string]string)}
+	p := &mqttSensorPublisher{
+		client:  client,
+		device:  &mqtthass.Device{},
+		configs: make(map[string][]byte),
+	}
+
+	if err := p.PublishSensor(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	var config mqttEntity
+	if err := json.Unmarshal([]byte(client.msgs[prefix+"/config"]), &config); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, config.AvailabilityTopic)
+	assert.Equal(t, "all", config.AvailabilityMode)
+	assert.Equal(t, []mqttAvailability{{Topic: mqttAvailabilityTopic()}, {Topic: prefix + "/availability"}}, config.Availability)
+	assert.Equal(t, "online", client.msgs[prefix+"/availability"])
+	assert.Equal(t, "42", client.msgs[prefix+"/state"])
+
+	// An unavailable sensor keeps its last state.
+	s.available = false
+	s.Value = 0
+	if err := p.PublishSensor(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "offline", client.msgs[prefix+"/availability"])
+	assert.Equal(t, "42", client.msgs[prefix+"/state"])
+}
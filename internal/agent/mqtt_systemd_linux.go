@@ -0,0 +1,84 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+
+	"github.com/joshuar/go-hass-agent/internal/linux/systemd"
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+)
+
+// addUnitControls adds, for each user unit listed as a control in the
+// preferences, a switch entity to the object that starts or stops the unit and
+// shows whether it is running, and a button entity that restarts it.
+func addUnitControls(ctx context.Context, o *mqttObj) {
+	prefs := preferences.FetchFromContext(ctx)
+	for _, name := range prefs.Systemd.Controls {
+		id := "unit_" + systemd.UnitID(name)
+		restartID := id + "_restart"
+
+		unitSwitch := newMQTTEntityConfig("switch", id).
+			WithIcon("mdi:cog").
+			WithCommandCallback(func(_ MQTT.Client, msg MQTT.Message) {
+				var err error
+				switch string(msg.Payload()) {
+				case switchOn:
+					err = systemd.StartUnit(ctx, true, name)
+				case switchOff:
+					err = systemd.StopUnit(ctx, true, name)
+				}
+				if err != nil {
+					log.Warn().Err(err).Str("unit", name).Msg("Could not change unit state.")
+				}
+			})
+		unitSwitch.Entity.Name = name
+		o.entities[id] = unitSwitch
+
+		restart := mqtthass.NewEntityByID(restartID, mqttAppName).
+			AsButton().
+			WithDefaultOriginInfo().
+			WithDeviceInfo(mqttDevice()).
+			WithIcon("mdi:restart").
+			WithCommandCallback(func(_ MQTT.Client, _ MQTT.Message) {
+				if err := systemd.RestartUnit(ctx, true, name); err != nil {
+					log.Warn().Err(err).Str("unit", name).Msg("Could not restart unit.")
+				}
+			})
+		restart.Entity.Name = "Restart " + name
+		o.entities[restartID] = restart
+
+		// The switch state follows the unit, however it was started or
+		// stopped.
+		o.watchers = append(o.watchers, func(ctx context.Context, client mqtthass.MQTTClient) {
+			publish := func(unit *systemd.Unit) {
+				state := switchOff
+				if unit.Running() {
+					state = switchOn
+				}
+				msg := mqttapi.NewMsg(unitSwitch.Entity.StateTopic, []byte(state)).Retain()
+				if err := client.Publish(msg); err != nil {
+					log.Warn().Err(err).Str("unit", name).Msg("Could not publish unit state.")
+				}
+			}
+			unit, err := systemd.GetUnit(ctx, true, name)
+			if err != nil {
+				log.Warn().Err(err).Str("unit", name).Msg("Could not get unit state.")
+				return
+			}
+			publish(unit)
+			if err := systemd.WatchUnit(ctx, true, name, publish); err != nil {
+				log.Warn().Err(err).Str("unit", name).Msg("Could not watch unit.")
+			}
+		})
+	}
+}
@@ -7,25 +7,26 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
-	"github.com/robfig/cron/v3"
 	"github.com/rs/zerolog/log"
 
 	mqtthass "github.com/joshuar/go-hass-anything/v5/pkg/hass"
-	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
 
 	"github.com/joshuar/go-hass-agent/internal/device"
 	"github.com/joshuar/go-hass-agent/internal/hass"
 	"github.com/joshuar/go-hass-agent/internal/hass/api"
+	mqttclient "github.com/joshuar/go-hass-agent/internal/mqtt"
 	"github.com/joshuar/go-hass-agent/internal/preferences"
 	"github.com/joshuar/go-hass-agent/internal/scripts"
 	"github.com/joshuar/go-hass-agent/internal/tracker"
 )
 
 // runWorkers will call all the sensor worker functions that have been defined
-// for this device.
-func runWorkers(ctx context.Context, trk SensorTracker) {
+// for this device. Any sensor updates that represent events scripts can be run
+// on are passed to the scripts runner.
+func runWorkers(ctx context.Context, trk SensorTracker, scriptsRunner *scripts.Runner) {
 	workerFuncs := sensorWorkers()
 	workerFuncs = append(workerFuncs, device.ExternalIPUpdater)
 
@@ -41,69 +42,55 @@ func runWorkers(ctx context.Context, trk SensorTracker) {
 	go func() {
 		log.Debug().Msg("Listening for sensor updates.")
 		defer wg.Done()
+		events := newScriptEvents()
+		events.watch(ctx, scriptsRunner.Trigger)
 		for s := range tracker.MergeSensorCh(ctx, outCh...) {
+			if event, ok := events.event(s); ok {
+				scriptsRunner.Trigger(event)
+			}
 			go func(s tracker.Sensor) {
 				trk.UpdateSensors(ctx, s)
 			}(s)
 		}
 	}()
-	wg.Add(1)
-	go func() {
-		log.Debug().Msg("Listening for location updates.")
-		defer wg.Done()
-		for l := range locationWorker()(ctx) {
-			go func(l *hass.LocationData) {
-				trk.UpdateSensors(ctx, l)
-			}(l)
-		}
-	}()
+	// Location updates can only be sent via the mobile_app integration.
+	if preferences.FetchFromContext(ctx).Registered {
+		wg.Add(1)
+		go func() {
+			log.Debug().Msg("Listening for location updates.")
+			defer wg.Done()
+			for l := range locationWorker()(ctx) {
+				go func(l *hass.LocationData) {
+					trk.UpdateSensors(ctx, l)
+				}(l)
+			}
+		}()
+	}
 
 	wg.Wait()
 }
 
-// runScripts will retrieve all scripts that the agent can run and queue them up
-// to be run on their defined schedule using the cron scheduler. It also sets up
-// a channel to receive script output and send appropriate sensor objects to the
-// tracker.
-func runScripts(ctx context.Context, path string, trk SensorTracker) {
-	allScripts, err := scripts.FindScripts(path)
-	switch {
-	case err != nil:
-		log.Error().Err(err).Msg("Error getting scripts.")
-		return
-	case len(allScripts) == 0:
-		log.Debug().Msg("Could not find any script files.")
-		return
-	}
-	c := cron.New()
-	var outCh []<-chan tracker.Sensor
-	for _, s := range allScripts {
-		schedule := s.Schedule()
-		if schedule != "" {
-			_, err := c.AddJob(schedule, s)
-			if err != nil {
-				log.Warn().Err(err).Str("script", s.Path()).
-					Msg("Unable to schedule script.")
-				break
-			}
-			outCh = append(outCh, s.Output)
-			log.Debug().Str("schedule", schedule).Str("script", s.Path()).
-				Msg("Added script sensor.")
-		}
-	}
-	log.Debug().Msg("Starting cron scheduler for script sensors.")
-	c.Start()
+// runScripts will run all scripts that the agent can run, either on their
+// defined schedule using the cron scheduler, or as streaming scripts. The
+// scripts directory is watched for changes so that scripts can be added,
+// removed or changed without restarting the agent. Any sensors output by
+// scripts are sent to the tracker.
+func runScripts(ctx context.Context, runner *scripts.Runner, trk SensorTracker) {
 	go func() {
-		for s := range tracker.MergeSensorCh(ctx, outCh...) {
-			go func(s tracker.Sensor) {
-				trk.UpdateSensors(ctx, s)
-			}(s)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case s := <-runner.Sensors():
+				go func(s tracker.Sensor) {
+					trk.UpdateSensors(ctx, s)
+				}(s)
+			}
 		}
 	}()
-	<-ctx.Done()
-	log.Debug().Msg("Stopping cron scheduler for script sensors.")
-	cronCtx := c.Stop()
-	<-cronCtx.Done()
+	if err := runner.Start(); err != nil {
+		log.Error().Err(err).Msg("Error getting scripts.")
+	}
 }
 
 // runNotificationsWorker will run a goroutine that is listening for
@@ -146,57 +133,78 @@ func (agent *Agent) runNotificationsWorker(ctx context.Context) {
 	wg.Wait()
 }
 
-// runMQTTWorker will set up a connection to MQTT and listen on topics for
-// controlling this device from Home Assistant.
-func runMQTTWorker(ctx context.Context) {
+// newMQTTClient will set up a connection to MQTT using the preferences in the
+// given context.
+func newMQTTClient(ctx context.Context) (*mqttclient.Client, error) {
 	prefs := preferences.FetchFromContext(ctx)
 	mqttprefs := &preferences.MQTTPreferences{
 		Prefs: &prefs,
 	}
+	return mqttclient.NewClient(ctx, mqttprefs, mqttAvailabilityTopic())
+}
 
-	c, err := mqttapi.NewMQTTClient(ctx, mqttprefs)
-	if err != nil {
-		log.Error().Err(err).Msg("Could not start MQTT client.")
-		return
-	}
-	o := newMQTTObject(ctx)
-	if !prefs.MQTTRegistered {
-		log.Debug().Msg("Registering agent with MQTT.")
-		if err := mqtthass.Register(o, c); err != nil {
-			log.Error().Err(err).Msg("Failed to register app!")
+// runMQTTWorker will listen on MQTT topics for controlling this device from
+// Home Assistant, using the given client or, if it is nil, a new connection.
+// A given client is shared with other workers, so it is left to the caller to
+// disconnect. Any commands provided by scripts are also made available as
+// buttons. The agent is marked as available while the worker runs and the
+// device is awake.
+func runMQTTWorker(ctx context.Context, c *mqttclient.Client, scriptsRunner *scripts.Runner) {
+	if c == nil {
+		var err error
+		if c, err = newMQTTClient(ctx); err != nil {
+			log.Error().Err(err).Msg("Could not start MQTT client.")
 			return
-		} else {
-			preferences.Save(preferences.MQTTRegistered(true))
 		}
+		defer c.Disconnect()
 	}
+	o := newMQTTObject(ctx)
+	if err := publishMQTTDiscovery(o, c); err != nil {
+		log.Error().Err(err).Msg("Failed to register app!")
+		return
+	}
+	// Publish the discovery configs again whenever the client reconnects, in
+	// case the broker has lost them (e.g., it was restarted without
+	// persistence).
+	reconnected := make(chan struct{}, 1)
+	c.OnConnect(func() {
+		if err := publishMQTTDiscovery(o, c); err != nil {
+			log.Warn().Err(err).Msg("Could not publish MQTT discovery configs.")
+		}
+		select {
+		case reconnected <- struct{}{}:
+		default:
+		}
+	})
 	if err := mqtthass.Subscribe(o, c); err != nil {
 		log.Error().Err(err).Msg("Could not activate subscriptions.")
 	}
+	if err := c.SetAvailability(true); err != nil {
+		log.Warn().Err(err).Msg("Could not publish MQTT availability.")
+	}
+	o.watch(ctx, c)
+	err := watchSleep(ctx, func(sleeping bool) {
+		if err := c.SetAvailability(!sleeping); err != nil {
+			log.Warn().Err(err).Msg("Could not publish MQTT availability.")
+		}
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not watch for suspend. Availability will not be updated on suspend.")
+	}
 	log.Debug().Msg("Listening for events on MQTT.")
 
-	<-ctx.Done()
+	runScriptCommands(ctx, scriptsRunner, c, o.guard, reconnected)
 }
 
-func resetMQTTWorker(ctx context.Context) {
-	prefs := preferences.FetchFromContext(ctx)
-	mqttprefs := &preferences.MQTTPreferences{
-		Prefs: &prefs,
-	}
-
-	c, err := mqttapi.NewMQTTClient(ctx, mqttprefs)
+// resetMQTTWorker will remove all entities the agent has published via MQTT
+// from Home Assistant.
+func resetMQTTWorker(ctx context.Context) error {
+	c, err := newMQTTClient(ctx)
 	if err != nil {
-		log.Error().Err(err).Msg("Could not start MQTT client.")
-		return
+		return fmt.Errorf("could not start MQTT client: %w", err)
 	}
+	defer c.Disconnect()
 
 	log.Info().Msgf("Clearing agent data from Home Assistant.")
-	d := newMQTTObject(ctx)
-
-	if prefs.MQTTRegistered {
-		if err := mqtthass.UnRegister(d, c); err != nil {
-			log.Error().Err(err).Msg("Failed to unregister app!")
-		} else {
-			preferences.Save(preferences.MQTTRegistered(false))
-		}
-	}
+	return clearMQTTDiscovery(ctx, c)
 }
@@ -0,0 +1,63 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package agent
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/linux/power"
+	"github.com/joshuar/go-hass-agent/internal/scripts"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+// scriptEvents watches the sensor updates from the workers for changes that
+// scripts can be run on. Screen unlocks are watched for separately, as the
+// screen lock sensor also reports the session becoming idle or active.
+type scriptEvents struct {
+	connections map[string]any
+	suspended   bool
+}
+
+func newScriptEvents() *scriptEvents {
+	return &scriptEvents{
+		connections: make(map[string]any),
+	}
+}
+
+// event returns the script event, if any, represented by the given sensor
+// update.
+func (e *scriptEvents) event(s tracker.Sensor) (scripts.Event, bool) {
+	l, ok := s.(interface{ Type() linux.SensorTypeValue })
+	if !ok {
+		return "", false
+	}
+	switch l.Type() {
+	case linux.SensorPowerState:
+		suspended := s.State() == "Suspended"
+		resumed := e.suspended && !suspended
+		e.suspended = suspended
+		return scripts.EventResume, resumed
+	case linux.SensorConnectionState:
+		// The first state seen for a connection is its initial state, not a
+		// change.
+		prev, seen := e.connections[s.ID()]
+		state := s.State()
+		e.connections[s.ID()] = state
+		return scripts.EventNetwork, seen && prev != state
+	}
+	return "", false
+}
+
+// watch calls trigger for the events that are not derived from sensor
+// updates.
+func (e *scriptEvents) watch(ctx context.Context, trigger func(scripts.Event)) {
+	if err := power.WatchUnlock(ctx, func() { trigger(scripts.EventUnlock) }); err != nil {
+		log.Warn().Err(err).Msg("Could not watch for screen unlocks. Unlock scripts will not run.")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -39,6 +40,7 @@ server (if not auto-detected) and long-lived access token.`
 	errMsgInvalidURL      = `You need to specify a valid http(s)://host:port.`
 	errMsgInvalidURI      = `You need to specify a valid scheme://host:port.`
 	errMsgInvalidHostPort = `You need to specify a valid host:port combination.`
+	errMsgInvalidNumber   = `You need to specify a valid, non-negative number.`
 )
 
 type fyneUI struct {
@@ -196,10 +198,18 @@ func (i *fyneUI) agentSettingsWindow() fyne.Window {
 
 	// MQTT settings
 	mqttPrefs := &ui.MQTTPreferences{
-		Enabled:  prefs.MQTTEnabled,
-		Server:   prefs.MQTTServer,
-		User:     prefs.MQTTUser,
-		Password: prefs.MQTTPassword,
+		Enabled:            prefs.MQTTEnabled,
+		Server:             prefs.MQTTServer,
+		User:               prefs.MQTTUser,
+		Password:           prefs.MQTTPassword,
+		Sensors:            prefs.MQTTSensors,
+		CAFile:             prefs.MQTTCAFile,
+		ClientCert:         prefs.MQTTClientCert,
+		ClientKey:          prefs.MQTTClientKey,
+		InsecureSkipVerify: prefs.MQTTInsecureSkipVerify,
+		ClientID:           prefs.MQTTClientID,
+		KeepAlive:          prefs.MQTTKeepAlive,
+		CleanSession:       prefs.MQTTCleanSession,
 	}
 	allFormItems = append(allFormItems, i.mqttConfigItems(mqttPrefs)...)
 
@@ -211,6 +221,14 @@ func (i *fyneUI) agentSettingsWindow() fyne.Window {
 			preferences.MQTTServer(mqttPrefs.Server),
 			preferences.MQTTUser(mqttPrefs.User),
 			preferences.MQTTPassword(mqttPrefs.Password),
+			preferences.MQTTSensors(mqttPrefs.Sensors),
+			preferences.MQTTCAFile(mqttPrefs.CAFile),
+			preferences.MQTTClientCert(mqttPrefs.ClientCert),
+			preferences.MQTTClientKey(mqttPrefs.ClientKey),
+			preferences.MQTTInsecureSkipVerify(mqttPrefs.InsecureSkipVerify),
+			preferences.MQTTClientID(mqttPrefs.ClientID),
+			preferences.MQTTKeepAlive(mqttPrefs.KeepAlive),
+			preferences.MQTTCleanSession(mqttPrefs.CleanSession),
 		)
 		if err != nil {
 			dialog.ShowError(err, w)
@@ -379,19 +397,74 @@ func (i *fyneUI) mqttConfigItems(prefs *ui.MQTTPreferences) []*widget.FormItem {
 	passwordFormItem := widget.NewFormItem(i.Translate("MQTT Password"), passwordEntry)
 	passwordFormItem.HintText = ui.MQTTPasswordHelp
 
+	sensorsCheck := configCheck(&prefs.Sensors, func(b bool) {
+		prefs.Sensors = b
+	})
+	sensorsCheck.Disable()
+	sensorsFormItem := widget.NewFormItem(i.Translate("Publish Sensors via MQTT?"), sensorsCheck)
+	sensorsFormItem.HintText = ui.MQTTSensorsHelp
+
+	caFileEntry := configEntry(&prefs.CAFile, false)
+	caFileEntry.Disable()
+	caFileFormItem := widget.NewFormItem(i.Translate("MQTT CA File"), caFileEntry)
+	caFileFormItem.HintText = ui.MQTTCAFileHelp
+
+	clientCertEntry := configEntry(&prefs.ClientCert, false)
+	clientCertEntry.Disable()
+	clientCertFormItem := widget.NewFormItem(i.Translate("MQTT Client Certificate"), clientCertEntry)
+	clientCertFormItem.HintText = ui.MQTTClientCertHelp
+
+	clientKeyEntry := configEntry(&prefs.ClientKey, false)
+	clientKeyEntry.Disable()
+	clientKeyFormItem := widget.NewFormItem(i.Translate("MQTT Client Key"), clientKeyEntry)
+	clientKeyFormItem.HintText = ui.MQTTClientKeyHelp
+
+	insecureCheck := configCheck(&prefs.InsecureSkipVerify, func(b bool) {
+		prefs.InsecureSkipVerify = b
+	})
+	insecureCheck.Disable()
+	insecureFormItem := widget.NewFormItem(i.Translate("Skip MQTT Certificate Verification?"), insecureCheck)
+	insecureFormItem.HintText = ui.MQTTInsecureSkipVerifyHelp
+
+	clientIDEntry := configEntry(&prefs.ClientID, false)
+	clientIDEntry.Disable()
+	clientIDFormItem := widget.NewFormItem(i.Translate("MQTT Client ID"), clientIDEntry)
+	clientIDFormItem.HintText = ui.MQTTClientIDHelp
+
+	keepAliveEntry := configIntEntry(&prefs.KeepAlive)
+	keepAliveEntry.Disable()
+	keepAliveFormItem := widget.NewFormItem(i.Translate("MQTT Keepalive"), keepAliveEntry)
+	keepAliveFormItem.HintText = ui.MQTTKeepAliveHelp
+
+	cleanSessionCheck := configCheck(&prefs.CleanSession, func(b bool) {
+		prefs.CleanSession = b
+	})
+	cleanSessionCheck.Disable()
+	cleanSessionFormItem := widget.NewFormItem(i.Translate("MQTT Clean Session?"), cleanSessionCheck)
+	cleanSessionFormItem.HintText = ui.MQTTCleanSessionHelp
+
+	mqttWidgets := []fyne.Disableable{
+		serverEntry,
+		userEntry,
+		passwordEntry,
+		sensorsCheck,
+		caFileEntry,
+		clientCertEntry,
+		clientKeyEntry,
+		insecureCheck,
+		clientIDEntry,
+		keepAliveEntry,
+		cleanSessionCheck,
+	}
 	mqttEnabled := configCheck(&prefs.Enabled, func(b bool) {
-		switch b {
-		case true:
-			serverEntry.Enable()
-			userEntry.Enable()
-			passwordEntry.Enable()
-			prefs.Enabled = true
-		case false:
-			serverEntry.Disable()
-			userEntry.Disable()
-			passwordEntry.Disable()
-			prefs.Enabled = false
+		for _, w := range mqttWidgets {
+			if b {
+				w.Enable()
+			} else {
+				w.Disable()
+			}
 		}
+		prefs.Enabled = b
 	})
 
 	var items []*widget.FormItem
@@ -400,6 +473,14 @@ func (i *fyneUI) mqttConfigItems(prefs *ui.MQTTPreferences) []*widget.FormItem {
 		serverFormItem,
 		userFormItem,
 		passwordFormItem,
+		sensorsFormItem,
+		caFileFormItem,
+		clientCertFormItem,
+		clientKeyFormItem,
+		insecureFormItem,
+		clientIDFormItem,
+		keepAliveFormItem,
+		cleanSessionFormItem,
 	)
 
 	return items
@@ -418,6 +499,21 @@ func configEntry(value *string, secret bool) *widget.Entry {
 	return entryWidget
 }
 
+// configIntEntry creates a form entry widget that is tied to the given integer
+// config value. When the value of the entry widget changes, the corresponding
+// config value will be updated.
+func configIntEntry(value *int) *widget.Entry {
+	boundEntry := binding.IntToString(binding.BindInt(value))
+	entryWidget := widget.NewEntryWithData(boundEntry)
+	entryWidget.Validator = func(text string) error {
+		if v, err := strconv.Atoi(text); err != nil || v < 0 {
+			return errors.New(errMsgInvalidNumber)
+		}
+		return nil
+	}
+	return entryWidget
+}
+
 // configCheck creates a form checkbox widget that is tied to the given config
 // value of the given agent. When the value of the entry widget changes, the
 // corresponding config value will be updated.
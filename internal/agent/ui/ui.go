@@ -23,10 +23,18 @@ type SensorTracker interface {
 }
 
 type MQTTPreferences struct {
-	Server   string
-	User     string
-	Password string
-	Enabled  bool
+	Server             string
+	User               string
+	Password           string
+	CAFile             string
+	ClientCert         string
+	ClientKey          string
+	ClientID           string
+	KeepAlive          int
+	Enabled            bool
+	Sensors            bool
+	InsecureSkipVerify bool
+	CleanSession       bool
 }
 
 //go:embed assets/appURL.txt
@@ -47,6 +55,30 @@ var MQTTUserHelp string
 //go:embed assets/mqttPasswordHelp.txt
 var MQTTPasswordHelp string
 
+//go:embed assets/mqttSensorsHelp.txt
+var MQTTSensorsHelp string
+
+//go:embed assets/mqttCAFileHelp.txt
+var MQTTCAFileHelp string
+
+//go:embed assets/mqttClientCertHelp.txt
+var MQTTClientCertHelp string
+
+//go:embed assets/mqttClientKeyHelp.txt
+var MQTTClientKeyHelp string
+
+//go:embed assets/mqttInsecureSkipVerifyHelp.txt
+var MQTTInsecureSkipVerifyHelp string
+
+//go:embed assets/mqttClientIDHelp.txt
+var MQTTClientIDHelp string
+
+//go:embed assets/mqttKeepAliveHelp.txt
+var MQTTKeepAliveHelp string
+
+//go:embed assets/mqttCleanSessionHelp.txt
+var MQTTCleanSessionHelp string
+
 //go:embed assets/logo-pretty.png
 var hassIcon []byte
 
@@ -14,7 +14,8 @@ import (
 )
 
 const (
-	StateUnknown = "unknown"
+	StateUnknown     = "unknown"
+	StateUnavailable = "unavailable"
 )
 
 // SensorRegistrationInfo is the JSON structure required to register a sensor
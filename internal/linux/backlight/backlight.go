@@ -0,0 +1,130 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+// Package backlight provides access to the brightness of the display and
+// keyboard backlights.
+package backlight
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/pkg/linux/dbusx"
+)
+
+const (
+	loginDBusDest              = "org.freedesktop.login1"
+	loginSetBrightnessMethod   = loginDBusDest + ".Session.SetBrightness"
+	backlightSubsystem         = "backlight"
+	backlightBrightnessFile    = "brightness"
+	backlightActualFile        = "actual_brightness"
+	backlightMaxBrightnessFile = "max_brightness"
+	backlightTypeFile          = "type"
+)
+
+var ErrNoBacklight = errors.New("no backlight found")
+
+// backlightTypes are the types of backlight devices, in order of preference.
+// This is the same order used by systemd and most desktop environments.
+var backlightTypes = []string{"firmware", "platform", "raw"}
+
+// Display represents a display backlight device in sysfs.
+type Display struct {
+	name          string
+	path          string
+	maxBrightness int
+}
+
+// Name returns the name of the backlight device (e.g., intel_backlight).
+func (d *Display) Name() string {
+	return d.name
+}
+
+// MaxBrightness returns the maximum brightness of the backlight.
+func (d *Display) MaxBrightness() int {
+	return d.maxBrightness
+}
+
+// Brightness returns the current brightness of the backlight.
+func (d *Display) Brightness() (int, error) {
+	// actual_brightness is the brightness reported by the hardware, which may
+	// differ from what was last set. Not all drivers provide it.
+	b, err := readInt(filepath.Join(d.path, backlightActualFile))
+	if err != nil {
+		return readInt(filepath.Join(d.path, backlightBrightnessFile))
+	}
+	return b, nil
+}
+
+// SetBrightness sets the brightness of the backlight. As the backlight files in
+// sysfs are usually only writable by root, the brightness is set through the
+// systemd-logind session of the user.
+func (d *Display) SetBrightness(ctx context.Context, brightness int) error {
+	brightness = min(max(brightness, 0), d.maxBrightness)
+	sessionPath := dbusx.GetSessionPath(ctx)
+	if sessionPath == "" {
+		return errors.New("could not find user session")
+	}
+	return dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Path(sessionPath).
+		Destination(loginDBusDest).
+		Call(loginSetBrightnessMethod, backlightSubsystem, d.name, uint32(brightness))
+}
+
+// GetDisplay returns the preferred display backlight device. If there are
+// multiple backlight devices, the preferred device is chosen by its type:
+// firmware, then platform and then raw.
+func GetDisplay() (*Display, error) {
+	classPath := filepath.Join(linux.SysfsRoot(), "class", backlightSubsystem)
+	entries, err := os.ReadDir(classPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var displays []*Display
+	var types []int
+	for _, entry := range entries {
+		path := filepath.Join(classPath, entry.Name())
+		maxBrightness, err := readInt(filepath.Join(path, backlightMaxBrightnessFile))
+		if err != nil || maxBrightness <= 0 {
+			continue
+		}
+		t := slices.Index(backlightTypes, linux.ReadString(filepath.Join(path, backlightTypeFile)))
+		if t < 0 {
+			t = len(backlightTypes)
+		}
+		displays = append(displays, &Display{
+			name:          entry.Name(),
+			path:          path,
+			maxBrightness: maxBrightness,
+		})
+		types = append(types, t)
+	}
+	if len(displays) == 0 {
+		return nil, ErrNoBacklight
+	}
+
+	preferred := 0
+	for i := range displays {
+		if types[i] < types[preferred] {
+			preferred = i
+		}
+	}
+	return displays[preferred], nil
+}
+
+func readInt(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package backlight
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joshuar/go-hass-agent/internal/linux"
+)
+
+// newFakeBacklight creates a backlight device in a fake sysfs tree at root.
+// Any file with an empty value is not created.
+func newFakeBacklight(t *testing.T, root, name string, files map[string]string) {
+	t.Helper()
+	path := filepath.Join(root, "class", "backlight", name)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for file, value := range files {
+		if value == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(path, file), []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetDisplay(t *testing.T) {
+	type backlight struct {
+		files map[string]string
+		name  string
+	}
+	tests := []struct {
+		wantErr        error
+		name           string
+		wantName       string
+		backlights     []backlight
+		wantMax        int
+		wantBrightness int
+	}{
+		{
+			name:    "no backlights",
+			wantErr: ErrNoBacklight,
+		},
+		{
+			name: "single backlight",
+			backlights: []backlight{
+				{name: "intel_backlight", files: map[string]string{"type": "raw", "max_brightness": "1000", "brightness": "400", "actual_brightness": "500"}},
+			},
+			wantName:       "intel_backlight",
+			wantMax:        1000,
+			wantBrightness: 500,
+		},
+		{
+			name: "no actual brightness",
+			backlights: []backlight{
+				{name: "amdgpu_bl0", files: map[string]string{"type": "raw", "max_brightness": "255", "brightness": "128"}},
+			},
+			wantName:       "amdgpu_bl0",
+			wantMax:        255,
+			wantBrightness: 128,
+		},
+		{
+			name: "prefers firmware",
+			backlights: []backlight{
+				{name: "intel_backlight", files: map[string]string{"type": "raw", "max_brightness": "1000", "brightness": "400"}},
+				{name: "acpi_video0", files: map[string]string{"type": "firmware", "max_brightness": "15", "brightness": "7"}},
+			},
+			wantName:       "acpi_video0",
+			wantMax:        15,
+			wantBrightness: 7,
+		},
+		{
+			name: "invalid max brightness",
+			backlights: []backlight{
+				{name: "broken", files: map[string]string{"type": "raw", "max_brightness": "0", "brightness": "0"}},
+			},
+			wantErr: ErrNoBacklight,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(root, "class", "backlight"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for _, b := range tt.backlights {
+				newFakeBacklight(t, root, b.name, b.files)
+			}
+			t.Setenv(linux.SysfsEnv, root)
+
+			got, err := GetDisplay()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetDisplay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Name() != tt.wantName {
+				t.Errorf("GetDisplay() name = %v, want %v", got.Name(), tt.wantName)
+			}
+			if got.MaxBrightness() != tt.wantMax {
+				t.Errorf("GetDisplay() max brightness = %v, want %v", got.MaxBrightness(), tt.wantMax)
+			}
+			brightness, err := got.Brightness()
+			if err != nil {
+				t.Fatalf("Brightness() error = %v", err)
+			}
+			if brightness != tt.wantBrightness {
+				t.Errorf("Brightness() = %v, want %v", brightness, tt.wantBrightness)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package backlight
+
+import (
+	"context"
+	"errors"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/joshuar/go-hass-agent/pkg/linux/dbusx"
+)
+
+const (
+	kbdBacklightDBusPath      = "/org/freedesktop/UPower/KbdBacklight"
+	kbdBacklightDBusDest      = "org.freedesktop.UPower"
+	kbdBacklightDBusInterface = kbdBacklightDBusDest + ".KbdBacklight"
+)
+
+// Keyboard represents the keyboard backlight, as provided by UPower.
+type Keyboard struct {
+	maxBrightness int
+}
+
+// MaxBrightness returns the maximum brightness of the keyboard backlight.
+func (k *Keyboard) MaxBrightness() int {
+	return k.maxBrightness
+}
+
+// Brightness returns the current brightness of the keyboard backlight.
+func (k *Keyboard) Brightness(ctx context.Context) (int, error) {
+	return getKbdBrightness(ctx, "GetBrightness")
+}
+
+// SetBrightness sets the brightness of the keyboard backlight.
+func (k *Keyboard) SetBrightness(ctx context.Context, brightness int) error {
+	brightness = min(max(brightness, 0), k.maxBrightness)
+	return dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Path(kbdBacklightDBusPath).
+		Destination(kbdBacklightDBusDest).
+		Call(kbdBacklightDBusInterface+".SetBrightness", int32(brightness))
+}
+
+// Watch calls the given function with the new brightness whenever the
+// brightness of the keyboard backlight changes, until the context is canceled.
+func (k *Keyboard) Watch(ctx context.Context, changed func(brightness int)) error {
+	return dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Match([]dbus.MatchOption{
+			dbus.WithMatchObjectPath(kbdBacklightDBusPath),
+			dbus.WithMatchInterface(kbdBacklightDBusInterface),
+			dbus.WithMatchMember("BrightnessChanged"),
+		}).
+		Handler(func(s *dbus.Signal) {
+			if s.Name != kbdBacklightDBusInterface+".BrightnessChanged" || len(s.Body) == 0 {
+				return
+			}
+			if brightness, ok := s.Body[0].(int32); ok {
+				changed(int(brightness))
+			} else {
+				log.Debug().Interface("body", s.Body).Msg("Unexpected keyboard brightness signal.")
+			}
+		}).
+		AddWatch(ctx)
+}
+
+// GetKeyboard returns the keyboard backlight. An error is returned if UPower
+// does not report a keyboard backlight.
+func GetKeyboard(ctx context.Context) (*Keyboard, error) {
+	maxBrightness, err := getKbdBrightness(ctx, "GetMaxBrightness")
+	if err != nil {
+		return nil, err
+	}
+	if maxBrightness <= 0 {
+		return nil, ErrNoBacklight
+	}
+	return &Keyboard{maxBrightness: maxBrightness}, nil
+}
+
+func getKbdBrightness(ctx context.Context, method string) (int, error) {
+	result := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Path(kbdBacklightDBusPath).
+		Destination(kbdBacklightDBusDest).
+		GetData(kbdBacklightDBusInterface + "." + method).
+		AsRawInterface()
+	brightness, ok := result.(int32)
+	if !ok {
+		return 0, errors.New("could not retrieve keyboard brightness")
+	}
+	return int(brightness), nil
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package disk
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/iancoleman/strcase"
+	"github.com/rs/zerolog/log"
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/joshuar/go-hass-agent/internal/device/helpers"
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+const ioPollInterval = 10 * time.Second
+
+// defaultExcludedDevices are the block devices not reported if no exclude
+// patterns are set in the preferences.
+var defaultExcludedDevices = []string{"loop*", "ram*", "zram*"}
+
+// deviceFilter chooses the block devices that have I/O sensors.
+type deviceFilter struct {
+	include    []string
+	exclude    []string
+	partitions bool
+}
+
+func newDeviceFilter(include, exclude []string, partitions bool) *deviceFilter {
+	if exclude == nil {
+		exclude = defaultExcludedDevices
+	}
+	return &deviceFilter{include: include, exclude: exclude, partitions: partitions}
+}
+
+// match returns whether the block device with the given name should be
+// reported.
+func (f *deviceFilter) match(name string) bool {
+	if linux.MatchAny(f.exclude, name) {
+		return false
+	}
+	if len(f.include) > 0 && !linux.MatchAny(f.include, name) {
+		return false
+	}
+	return f.partitions || !isPartition(name)
+}
+
+// isPartition returns whether the block device with the given name is a
+// partition of another device.
+func isPartition(name string) bool {
+	_, err := os.Stat(filepath.Join(linux.SysfsRoot(), "class", "block", name, "partition"))
+	return err == nil
+}
+
+// ioSample is the I/O counters of a block device at a point in time.
+type ioSample struct {
+	at       time.Time
+	counters disk.IOCountersStat
+}
+
+// ioRates are the rates of I/O on a block device between two samples.
+type ioRates struct {
+	ReadBytes  float64
+	WriteBytes float64
+	ReadOps    float64
+	WriteOps   float64
+	// Busy is the percentage of time the device was processing I/O.
+	Busy float64
+}
+
+// rates returns the rates of I/O between the previous and current samples.
+func rates(prev, current *ioSample) *ioRates {
+	elapsed := current.at.Sub(prev.at)
+	if elapsed <= 0 {
+		return &ioRates{}
+	}
+	secs := elapsed.Seconds()
+	perSec := func(last, now uint64) float64 {
+		// Counters are reset if the device is removed and added again.
+		if now < last {
+			return 0
+		}
+		return float64(now-last) / secs
+	}
+	r := &ioRates{
+		ReadBytes:  perSec(prev.counters.ReadBytes, current.counters.ReadBytes),
+		WriteBytes: perSec(prev.counters.WriteBytes, current.counters.WriteBytes),
+		ReadOps:    perSec(prev.counters.ReadCount, current.counters.ReadCount),
+		WriteOps:   perSec(prev.counters.WriteCount, current.counters.WriteCount),
+	}
+	// IoTime is in milliseconds.
+	r.Busy = math.Min(perSec(prev.counters.IoTime, current.counters.IoTime)/10, 100)
+	return r
+}
+
+type diskIOSensor struct {
+	device string
+	rates  *ioRates
+	linux.Sensor
+}
+
+type diskIOSensorAttributes struct {
+	DataSource string  `json:"Data Source"`
+	ReadIOPS   float64 `json:"Read IOPS"`
+	WriteIOPS  float64 `json:"Write IOPS"`
+}
+
+func (s *diskIOSensor) Name() string {
+	return "Disk " + s.device + " " + s.SensorTypeValue.String()
+}
+
+func (s *diskIOSensor) ID() string {
+	return "disk_" + strings.ReplaceAll(s.device, "-", "_") + "_" + strcase.ToSnake(s.SensorTypeValue.String())
+}
+
+func (s *diskIOSensor) Attributes() any {
+	if s.SensorTypeValue == linux.SensorDiskIOPS {
+		return &diskIOSensorAttributes{
+			DataSource: linux.DataSrcProcfs,
+			ReadIOPS:   round(s.rates.ReadOps),
+			WriteIOPS:  round(s.rates.WriteOps),
+		}
+	}
+	return s.Sensor.Attributes()
+}
+
+// newDiskIOSensors creates the read and write rate, IOPS and utilization
+// sensors for a block device.
+func newDiskIOSensors(device string, r *ioRates) []tracker.Sensor {
+	newSensor := func(t linux.SensorTypeValue, value float64, units, icon string) *diskIOSensor {
+		s := &diskIOSensor{device: device, rates: r}
+		s.Value = round(value)
+		s.SensorTypeValue = t
+		s.SensorSrc = linux.DataSrcProcfs
+		s.UnitsString = units
+		s.IconString = icon
+		s.StateClassValue = sensor.StateMeasurement
+		return s
+	}
+	readRate := newSensor(linux.SensorDiskReadRate, r.ReadBytes, "B/s", "mdi:file-download")
+	readRate.DeviceClassValue = sensor.Data_rate
+	writeRate := newSensor(linux.SensorDiskWriteRate, r.WriteBytes, "B/s", "mdi:file-upload")
+	writeRate.DeviceClassValue = sensor.Data_rate
+	return []tracker.Sensor{
+		readRate,
+		writeRate,
+		newSensor(linux.SensorDiskIOPS, r.ReadOps+r.WriteOps, "IOPS", "mdi:swap-vertical"),
+		newSensor(linux.SensorDiskUtilization, r.Busy, "%", "mdi:harddisk"),
+	}
+}
+
+// round rounds a value to two decimal places.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// IOUpdater reports the read and write throughput, IOPS and utilization of
+// each block device chosen by the preferences, from /proc/diskstats.
+// Partitions, loop and RAM devices are not reported by default.
+func IOUpdater(ctx context.Context) chan tracker.Sensor {
+	sensorCh := make(chan tracker.Sensor)
+	prefs := preferences.FetchFromContext(ctx)
+	filter := newDeviceFilter(prefs.Disk.Devices, prefs.Disk.ExcludeDevices, prefs.Disk.Partitions)
+
+	last := make(map[string]*ioSample)
+	sendDiskIOStats := func(_ time.Duration) {
+		counters, err := disk.IOCountersWithContext(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not retrieve disk I/O stats.")
+			return
+		}
+		now := time.Now()
+		for name, c := range counters {
+			if !filter.match(name) {
+				continue
+			}
+			current := &ioSample{at: now, counters: c}
+			prev, ok := last[name]
+			last[name] = current
+			// Rates need two samples.
+			if !ok {
+				continue
+			}
+			for _, s := range newDiskIOSensors(name, rates(prev, current)) {
+				sensorCh <- s
+			}
+		}
+	}
+
+	go helpers.PollSensors(ctx, sendDiskIOStats, ioPollInterval, time.Second)
+	go func() {
+		defer close(sensorCh)
+		<-ctx.Done()
+		log.Debug().Msg("Stopped disk I/O sensors.")
+	}()
+	return sensorCh
+}
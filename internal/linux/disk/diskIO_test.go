@@ -0,0 +1,113 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/joshuar/go-hass-agent/internal/linux"
+)
+
+func Test_deviceFilter_match(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv(linux.SysfsEnv, root)
+	for _, name := range []string{"sda1", "nvme0n1p2"} {
+		if err := os.MkdirAll(filepath.Join(root, "class", "block", name, "partition"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	devices := []string{"sda", "sda1", "nvme0n1", "nvme0n1p2", "loop0", "ram0", "zram0", "dm-0"}
+
+	tests := []struct {
+		name       string
+		include    []string
+		exclude    []string
+		partitions bool
+		want       []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"sda", "nvme0n1", "dm-0"},
+		},
+		{
+			name:       "with partitions",
+			partitions: true,
+			want:       []string{"sda", "sda1", "nvme0n1", "nvme0n1p2", "dm-0"},
+		},
+		{
+			name:    "include patterns",
+			include: []string{"nvme*", "loop*"},
+			want:    []string{"nvme0n1"},
+		},
+		{
+			name:    "exclude patterns",
+			exclude: []string{"dm-*"},
+			want:    []string{"sda", "nvme0n1", "loop0", "ram0", "zram0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newDeviceFilter(tt.include, tt.exclude, tt.partitions)
+			var got []string
+			for _, name := range devices {
+				if f.match(name) {
+					got = append(got, name)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_rates(t *testing.T) {
+	start := time.Now()
+	prev := &ioSample{at: start, counters: disk.IOCountersStat{
+		ReadBytes: 1000, WriteBytes: 5000, ReadCount: 10, WriteCount: 50, IoTime: 2000,
+	}}
+	tests := []struct {
+		name    string
+		current *ioSample
+		want    *ioRates
+	}{
+		{
+			name: "busy",
+			current: &ioSample{at: start.Add(10 * time.Second), counters: disk.IOCountersStat{
+				ReadBytes: 21000, WriteBytes: 105000, ReadCount: 30, WriteCount: 150, IoTime: 7000,
+			}},
+			want: &ioRates{ReadBytes: 2000, WriteBytes: 10000, ReadOps: 2, WriteOps: 10, Busy: 50},
+		},
+		{
+			name: "utilization capped",
+			current: &ioSample{at: start.Add(time.Second), counters: disk.IOCountersStat{
+				ReadBytes: 1000, WriteBytes: 5000, ReadCount: 10, WriteCount: 50, IoTime: 3500,
+			}},
+			want: &ioRates{Busy: 100},
+		},
+		{
+			name: "counters reset",
+			current: &ioSample{at: start.Add(10 * time.Second), counters: disk.IOCountersStat{
+				ReadBytes: 10, WriteBytes: 10, ReadCount: 1, WriteCount: 1, IoTime: 1,
+			}},
+			want: &ioRates{},
+		},
+		{
+			name:    "no time elapsed",
+			current: &ioSample{at: start},
+			want:    &ioRates{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rates(prev, tt.current))
+		})
+	}
+}
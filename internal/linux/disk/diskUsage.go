@@ -8,44 +8,194 @@ package disk
 import (
 	"context"
 	"math"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	"github.com/godbus/dbus/v5"
 	"github.com/rs/zerolog/log"
 	"github.com/shirou/gopsutil/v3/disk"
 
 	"github.com/joshuar/go-hass-agent/internal/device/helpers"
 	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
 	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/preferences"
 	"github.com/joshuar/go-hass-agent/internal/tracker"
+	"github.com/joshuar/go-hass-agent/pkg/linux/dbusx"
 )
 
+const (
+	udisks2DBusPath         = "/org/freedesktop/UDisks2"
+	udisks2FSInterface      = "org.freedesktop.UDisks2.Filesystem"
+	interfacesRemovedSignal = "org.freedesktop.DBus.ObjectManager.InterfacesRemoved"
+)
+
+var (
+	// defaultExcludedFilesystems are the filesystem types not reported if no
+	// excluded filesystems are set in the preferences.
+	defaultExcludedFilesystems = []string{"squashfs"}
+	// devDiskByUUID is the directory of links from filesystem UUIDs to the
+	// devices holding them.
+	devDiskByUUID = "/dev/disk/by-uuid"
+)
+
+// mountFilter chooses the mounts that have usage sensors.
+type mountFilter struct {
+	filesystems        []string
+	excludeFilesystems []string
+	mountpoints        []string
+	excludeMountpoints []string
+}
+
+func newMountFilter(prefs preferences.DiskConfig) *mountFilter {
+	f := &mountFilter{
+		filesystems:        prefs.Filesystems,
+		excludeFilesystems: prefs.ExcludeFilesystems,
+		mountpoints:        prefs.Mountpoints,
+		excludeMountpoints: prefs.ExcludeMountpoints,
+	}
+	if f.excludeFilesystems == nil {
+		f.excludeFilesystems = defaultExcludedFilesystems
+	}
+	return f
+}
+
+// match returns whether the given mount should be reported.
+func (f *mountFilter) match(p disk.PartitionStat) bool {
+	if slices.Contains(f.excludeFilesystems, p.Fstype) {
+		return false
+	}
+	if len(f.filesystems) > 0 && !slices.Contains(f.filesystems, p.Fstype) {
+		return false
+	}
+	if matchMountpoint(f.excludeMountpoints, p.Mountpoint) {
+		return false
+	}
+	return len(f.mountpoints) == 0 || matchMountpoint(f.mountpoints, p.Mountpoint)
+}
+
+// matchMountpoint returns whether the mountpoint, or any directory above it,
+// matches any of the given shell patterns.
+func matchMountpoint(patterns []string, mountpoint string) bool {
+	for dir := filepath.Clean(mountpoint); ; dir = filepath.Dir(dir) {
+		if linux.MatchAny(patterns, dir) {
+			return true
+		}
+		if dir == "/" || dir == "." {
+			return false
+		}
+	}
+}
+
+// filesystemUUIDs returns the UUID of the filesystem on each device, keyed by
+// the path of the device.
+func filesystemUUIDs() map[string]string {
+	uuids := make(map[string]string)
+	entries, err := os.ReadDir(devDiskByUUID)
+	if err != nil {
+		return uuids
+	}
+	for _, entry := range entries {
+		device, err := filepath.EvalSymlinks(filepath.Join(devDiskByUUID, entry.Name()))
+		if err != nil {
+			continue
+		}
+		uuids[device] = entry.Name()
+	}
+	return uuids
+}
+
+// mountID returns an ID for the given mount that stays the same if it is
+// mounted somewhere else. It is based on the UUID of the filesystem and, for
+// btrfs, the subvolume mounted. If the filesystem has no UUID, the ID is based
+// on the mountpoint.
+func mountID(p disk.PartitionStat, uuids map[string]string) string {
+	device := p.Device
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	uuid, ok := uuids[device]
+	if !ok {
+		if p.Mountpoint == "/" {
+			return "mountpoint_root"
+		}
+		return "mountpoint" + strings.ReplaceAll(p.Mountpoint, "/", "_")
+	}
+	id := "filesystem_" + idSafe(uuid)
+	for _, opt := range p.Opts {
+		if subvol, ok := strings.CutPrefix(opt, "subvol="); ok && subvol != "/" {
+			id += "_" + idSafe(strings.Trim(subvol, "/"))
+		}
+	}
+	return id
+}
+
+// idSafe converts a string into a form that can be used in IDs.
+func idSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, s)
+}
+
 type diskSensor struct {
 	stats *disk.UsageStat
+	id    string
+	// unmounted is whether the mount has gone, in which case the sensor is
+	// unavailable.
+	unmounted bool
 	linux.Sensor
 }
 
-func newDiskSensor(d *disk.UsageStat) *diskSensor {
-	s := &diskSensor{}
+func newDiskSensor(d *disk.UsageStat, id string, sensorType linux.SensorTypeValue) *diskSensor {
+	s := &diskSensor{id: id}
 	s.IconString = "mdi:harddisk"
 	s.StateClassValue = sensor.StateTotal
 	s.UnitsString = "%"
+	s.SensorTypeValue = sensorType
 	s.stats = d
-	s.Value = math.Round(d.UsedPercent/0.05) * 0.05
+	if sensorType == linux.SensorDiskInodes {
+		s.Value = math.Round(d.InodesUsedPercent/0.05) * 0.05
+	} else {
+		s.Value = math.Round(d.UsedPercent/0.05) * 0.05
+	}
 	return s
 }
 
+// newDiskSensors creates the usage sensors for a mount. Filesystems without
+// inodes (e.g., vfat) do not have an inode usage sensor.
+func newDiskSensors(d *disk.UsageStat, id string) []*diskSensor {
+	sensors := []*diskSensor{newDiskSensor(d, id, linux.SensorDiskUsage)}
+	if d.InodesTotal > 0 {
+		sensors = append(sensors, newDiskSensor(d, id, linux.SensorDiskInodes))
+	}
+	return sensors
+}
+
+// unavailable returns a copy of the sensor marked as unavailable.
+func (d *diskSensor) unavailable() *diskSensor {
+	s := *d
+	s.unmounted = true
+	return &s
+}
+
 // diskUsageState implements hass.SensorUpdate
 
 func (d *diskSensor) Name() string {
-	return "Mountpoint " + d.stats.Path + " Usage"
+	return "Mountpoint " + d.stats.Path + " " + d.SensorTypeValue.String()
 }
 
 func (d *diskSensor) ID() string {
-	if d.stats.Path == "/" {
-		return "mountpoint_root"
+	if d.SensorTypeValue == linux.SensorDiskInodes {
+		return d.id + "_inodes"
 	}
-	return "mountpoint" + strings.ReplaceAll(d.stats.Path, "/", "_")
+	return d.id
 }
 
 func (d *diskSensor) Attributes() any {
@@ -58,31 +208,129 @@ func (d *diskSensor) Attributes() any {
 	}
 }
 
+func (d *diskSensor) Available() bool {
+	return !d.unmounted
+}
+
+// watchMounts calls changed whenever UDisks2 reports a filesystem being
+// mounted, unmounted or removed.
+func watchMounts(ctx context.Context, changed func()) error {
+	return dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Match([]dbus.MatchOption{
+			dbus.WithMatchPathNamespace(udisks2DBusPath),
+		}).
+		Handler(func(s *dbus.Signal) {
+			if !strings.HasPrefix(string(s.Path), udisks2DBusPath) {
+				return
+			}
+			switch s.Name {
+			case dbusx.PropChangedSignal:
+				if len(s.Body) < 2 {
+					return
+				}
+				if intr, ok := s.Body[0].(string); !ok || intr != udisks2FSInterface {
+					return
+				}
+				if props, ok := s.Body[1].(map[string]dbus.Variant); ok {
+					if _, ok := props["MountPoints"]; ok {
+						changed()
+					}
+				}
+			case interfacesRemovedSignal:
+				if len(s.Body) < 2 {
+					return
+				}
+				if intrs, ok := s.Body[1].([]string); ok && slices.Contains(intrs, udisks2FSInterface) {
+					changed()
+				}
+			}
+		}).
+		AddWatch(ctx)
+}
+
+// UsageUpdater reports the space and inode usage of each mount chosen by the
+// filesystem and mountpoint filters in the preferences. Usage is updated every
+// minute and whenever UDisks2 reports a filesystem being mounted or unmounted,
+// when the sensors of a mount that has gone are marked unavailable.
 func UsageUpdater(ctx context.Context) chan tracker.Sensor {
 	sensorCh := make(chan tracker.Sensor, 1)
+	prefs := preferences.FetchFromContext(ctx)
+	filter := newMountFilter(prefs.Disk)
+
+	// Updates are also run from D-Bus signal handlers, which may still run
+	// after the context is canceled, so updating and closing are serialized.
+	var mu sync.Mutex
+	closed := false
+	send := func(s tracker.Sensor) {
+		select {
+		case sensorCh <- s:
+		case <-ctx.Done():
+		}
+	}
+	// mounted holds the sensors last sent for each mountpoint.
+	mounted := make(map[string][]*diskSensor)
 	sendDiskUsageStats := func(_ time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
 		p, err := disk.PartitionsWithContext(ctx, false)
 		if err != nil {
 			log.Warn().Err(err).
 				Msg("Could not retrieve list of physical partitions.")
 			return
 		}
+		uuids := filesystemUUIDs()
+		current := make(map[string][]*diskSensor)
+		ids := make(map[string]bool)
 		for _, partition := range p {
+			if !filter.match(partition) {
+				continue
+			}
+			// The same filesystem can be mounted more than once (e.g., bind
+			// mounts); only the first is reported.
+			id := mountID(partition, uuids)
+			if ids[id] {
+				continue
+			}
 			usage, err := disk.UsageWithContext(ctx, partition.Mountpoint)
 			if err != nil {
-				log.Warn().Err(err).
-					Msgf("Failed to get usage info for mountpount %s.", partition.Mountpoint)
-				return
-			} else {
-				sensorCh <- newDiskSensor(usage)
+				log.Debug().Err(err).
+					Msgf("Failed to get usage info for mountpoint %s.", partition.Mountpoint)
+				continue
+			}
+			ids[id] = true
+			sensors := newDiskSensors(usage, id)
+			current[partition.Mountpoint] = sensors
+			for _, s := range sensors {
+				send(s)
 			}
 		}
+		for mountpoint, sensors := range mounted {
+			if _, ok := current[mountpoint]; ok {
+				continue
+			}
+			for _, s := range sensors {
+				if !ids[s.id] {
+					send(s.unavailable())
+				}
+			}
+		}
+		mounted = current
 	}
 
 	go helpers.PollSensors(ctx, sendDiskUsageStats, time.Minute, time.Second*5)
+	if err := watchMounts(ctx, func() { go sendDiskUsageStats(0) }); err != nil {
+		log.Debug().Err(err).
+			Msg("Could not watch UDisks2 for mounts. Disk usage will only be updated every minute.")
+	}
 	go func() {
-		defer close(sensorCh)
 		<-ctx.Done()
+		mu.Lock()
+		closed = true
+		close(sensorCh)
+		mu.Unlock()
 		log.Debug().Msg("Stopped disk usage sensors.")
 	}()
 	return sensorCh
@@ -0,0 +1,125 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+)
+
+func Test_mountFilter_match(t *testing.T) {
+	mounts := []disk.PartitionStat{
+		{Mountpoint: "/", Fstype: "ext4"},
+		{Mountpoint: "/home", Fstype: "btrfs"},
+		{Mountpoint: "/boot/efi", Fstype: "vfat"},
+		{Mountpoint: "/snap/core/1", Fstype: "squashfs"},
+		{Mountpoint: "/media/user/USB", Fstype: "exfat"},
+	}
+
+	tests := []struct {
+		name  string
+		prefs preferences.DiskConfig
+		want  []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"/", "/home", "/boot/efi", "/media/user/USB"},
+		},
+		{
+			name:  "filesystems",
+			prefs: preferences.DiskConfig{Filesystems: []string{"ext4", "squashfs"}},
+			want:  []string{"/"},
+		},
+		{
+			name:  "exclude filesystems",
+			prefs: preferences.DiskConfig{ExcludeFilesystems: []string{"vfat"}},
+			want:  []string{"/", "/home", "/snap/core/1", "/media/user/USB"},
+		},
+		{
+			name:  "mountpoints match directories above",
+			prefs: preferences.DiskConfig{Mountpoints: []string{"/media/*", "/boot"}},
+			want:  []string{"/boot/efi", "/media/user/USB"},
+		},
+		{
+			name:  "exclude mountpoints",
+			prefs: preferences.DiskConfig{ExcludeMountpoints: []string{"/boot", "/home"}},
+			want:  []string{"/", "/media/user/USB"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newMountFilter(tt.prefs)
+			var got []string
+			for _, m := range mounts {
+				if f.match(m) {
+					got = append(got, m.Mountpoint)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_mountID(t *testing.T) {
+	dir := t.TempDir()
+	devDiskByUUID = filepath.Join(dir, "by-uuid")
+	t.Cleanup(func() { devDiskByUUID = "/dev/disk/by-uuid" })
+	if err := os.Mkdir(devDiskByUUID, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for uuid, device := range map[string]string{"1234-ABCD": "sda1", "0e6b2b6e-5d2f-4e8e": "nvme0n1p2"} {
+		if err := os.WriteFile(filepath.Join(dir, device), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join("..", device), filepath.Join(devDiskByUUID, uuid)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uuids := filesystemUUIDs()
+
+	tests := []struct {
+		name string
+		p    disk.PartitionStat
+		want string
+	}{
+		{
+			name: "uuid",
+			p:    disk.PartitionStat{Device: filepath.Join(dir, "sda1"), Mountpoint: "/media/user/USB"},
+			want: "filesystem_1234_abcd",
+		},
+		{
+			name: "btrfs subvolume",
+			p:    disk.PartitionStat{Device: filepath.Join(dir, "nvme0n1p2"), Mountpoint: "/home", Opts: []string{"rw", "subvol=/@home"}},
+			want: "filesystem_0e6b2b6e_5d2f_4e8e__home",
+		},
+		{
+			name: "btrfs top level",
+			p:    disk.PartitionStat{Device: filepath.Join(dir, "nvme0n1p2"), Mountpoint: "/mnt", Opts: []string{"subvol=/"}},
+			want: "filesystem_0e6b2b6e_5d2f_4e8e",
+		},
+		{
+			name: "no uuid",
+			p:    disk.PartitionStat{Device: "tmpfs", Mountpoint: "/run/user/1000"},
+			want: "mountpoint_run_user_1000",
+		},
+		{
+			name: "no uuid root",
+			p:    disk.PartitionStat{Device: "rootfs", Mountpoint: "/"},
+			want: "mountpoint_root",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, mountID(tt.p, uuids))
+		})
+	}
+}
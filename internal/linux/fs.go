@@ -0,0 +1,61 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package linux
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// ProcfsEnv and SysfsEnv are the environment variables that can be used
+	// to change the roots of the procfs and sysfs trees (e.g., to fake trees
+	// for testing). They are the same variables used by gopsutil.
+	ProcfsEnv     = "HOST_PROC"
+	procfsDefault = "/proc"
+	SysfsEnv      = "HOST_SYS"
+	sysfsDefault  = "/sys"
+)
+
+// ProcfsRoot returns the root of the procfs tree.
+func ProcfsRoot() string {
+	return envRoot(ProcfsEnv, procfsDefault)
+}
+
+// SysfsRoot returns the root of the sysfs tree.
+func SysfsRoot() string {
+	return envRoot(SysfsEnv, sysfsDefault)
+}
+
+func envRoot(env, def string) string {
+	if root, ok := os.LookupEnv(env); ok && root != "" {
+		return root
+	}
+	return def
+}
+
+// ReadString returns the contents of the file at the given path, with any
+// surrounding whitespace removed. It returns an empty string if the file
+// cannot be read.
+func ReadString(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// MatchAny returns whether the name matches any of the given shell patterns.
+// Invalid patterns never match.
+func MatchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
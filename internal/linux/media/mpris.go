@@ -0,0 +1,506 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+// Package media monitors media players that implement the MPRIS D-Bus
+// interface and provides control of them.
+package media
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/joshuar/go-hass-agent/pkg/linux/dbusx"
+)
+
+const (
+	mprisPrefix          = "org.mpris.MediaPlayer2."
+	mprisPath            = "/org/mpris/MediaPlayer2"
+	mprisInterface       = "org.mpris.MediaPlayer2"
+	mprisPlayerInterface = mprisInterface + ".Player"
+	mprisSeekedSignal    = mprisPlayerInterface + ".Seeked"
+
+	dbusDest               = "org.freedesktop.DBus"
+	dbusPath               = "/org/freedesktop/DBus"
+	dbusNameOwnerChanged   = dbusDest + ".NameOwnerChanged"
+	dbusPropertiesIntr     = dbusDest + ".Properties"
+	dbusListNamesMethod    = dbusDest + ".ListNames"
+	dbusGetNameOwnerMethod = dbusDest + ".GetNameOwner"
+
+	// StatusPlaying, StatusPaused and StatusStopped are the playback statuses
+	// of a player.
+	StatusPlaying = "Playing"
+	StatusPaused  = "Paused"
+	StatusStopped = "Stopped"
+
+	// positionInterval is how often the position of a playing player is
+	// refreshed, as players do not signal position changes during playback.
+	positionInterval = 10 * time.Second
+)
+
+var ErrNoPlayer = errors.New("no active media player")
+
+// State is the state of a media player.
+type State struct {
+	// Player is the D-Bus name of the player (e.g.,
+	// org.mpris.MediaPlayer2.spotify). It is empty if there is no player.
+	Player string
+	// Identity is the friendly name of the player (e.g., Spotify).
+	Identity string
+	Status   string
+	Title    string
+	Artist   string
+	Album    string
+	trackID  dbus.ObjectPath
+	Position time.Duration
+	Length   time.Duration
+	// Volume is the volume of the player, between 0 and 1.
+	Volume float64
+}
+
+// Monitor tracks the MPRIS media players on the session bus. Controls act on
+// the most recently active player, which is the player that most recently
+// started playing (or, if none are playing, that most recently changed). A
+// single Monitor can be shared by everything that needs media player state; see
+// Setup.
+type Monitor struct {
+	players map[string]*State
+	owners  map[string]string
+	subs    []chan State
+	active  string
+	mu      sync.Mutex
+	closed  bool
+}
+
+type monitorCtxKey struct{}
+
+// sharedMonitor is a Monitor that is started when first used.
+type sharedMonitor struct {
+	ctx     context.Context
+	monitor *Monitor
+	err     error
+	once    sync.Once
+}
+
+// Setup returns a new Context that shares a single Monitor between everything
+// that uses it. The Monitor is started on the first call to MonitorFromContext
+// and will stop when the given context is canceled.
+func Setup(ctx context.Context) context.Context {
+	return context.WithValue(ctx, monitorCtxKey{}, &sharedMonitor{ctx: ctx})
+}
+
+// MonitorFromContext returns the Monitor shared by the given context, starting
+// it if needed. If the context does not share a Monitor, a new one is started.
+func MonitorFromContext(ctx context.Context) (*Monitor, error) {
+	shared, ok := ctx.Value(monitorCtxKey{}).(*sharedMonitor)
+	if !ok {
+		return NewMonitor(ctx)
+	}
+	shared.once.Do(func() {
+		shared.monitor, shared.err = NewMonitor(shared.ctx)
+	})
+	return shared.monitor, shared.err
+}
+
+// NewMonitor will start monitoring the media players on the session bus. It
+// will stop when the given context is canceled.
+func NewMonitor(ctx context.Context) (*Monitor, error) {
+	m := &Monitor{
+		players: make(map[string]*State),
+		owners:  make(map[string]string),
+	}
+
+	names := dbusx.NewBusRequest(ctx, dbusx.SessionBus).
+		Path(dbusPath).
+		Destination(dbusDest).
+		GetData(dbusListNamesMethod).
+		AsStringList()
+	for _, name := range names {
+		if strings.HasPrefix(name, mprisPrefix) {
+			m.addPlayer(ctx, name, "")
+		}
+	}
+
+	err := dbusx.NewBusRequest(ctx, dbusx.SessionBus).
+		Match([]dbus.MatchOption{
+			dbus.WithMatchObjectPath(dbusPath),
+			dbus.WithMatchInterface(dbusDest),
+			dbus.WithMatchMember("NameOwnerChanged"),
+			dbus.WithMatchArg0Namespace(strings.TrimSuffix(mprisPrefix, ".")),
+		}).
+		Handler(func(s *dbus.Signal) {
+			if s.Name != dbusNameOwnerChanged || len(s.Body) < 3 {
+				return
+			}
+			name, _ := s.Body[0].(string)
+			newOwner, _ := s.Body[2].(string)
+			if !strings.HasPrefix(name, mprisPrefix) {
+				return
+			}
+			if newOwner == "" {
+				m.removePlayer(name)
+			} else {
+				m.addPlayer(ctx, name, newOwner)
+			}
+		}).
+		AddWatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dbusx.NewBusRequest(ctx, dbusx.SessionBus).
+		Match([]dbus.MatchOption{
+			dbus.WithMatchObjectPath(mprisPath),
+		}).
+		Handler(func(s *dbus.Signal) {
+			if s.Path != mprisPath {
+				return
+			}
+			switch s.Name {
+			case dbusx.PropChangedSignal:
+				if len(s.Body) < 2 {
+					return
+				}
+				if intr, ok := s.Body[0].(string); !ok || intr != mprisPlayerInterface {
+					return
+				}
+				if props, ok := s.Body[1].(map[string]dbus.Variant); ok {
+					m.updatePlayer(ctx, s.Sender, props)
+				}
+			case mprisSeekedSignal:
+				if len(s.Body) == 0 {
+					return
+				}
+				if position, ok := s.Body[0].(int64); ok {
+					m.updatePlayer(ctx, s.Sender, map[string]dbus.Variant{
+						"Position": dbus.MakeVariant(position),
+					})
+				}
+			}
+		}).
+		AddWatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ticker := time.NewTicker(positionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				m.close()
+				return
+			case <-ticker.C:
+				m.refreshPosition(ctx)
+			}
+		}
+	}()
+
+	return m, nil
+}
+
+// Updates returns a channel on which the state of the active player is sent,
+// starting with its current state and then whenever it changes. If there is no
+// active player, an empty state (with a Stopped status) is sent. Only the
+// latest state is kept if the channel is not read from fast enough. Each call
+// returns a new channel, which is closed when the monitor stops.
+func (m *Monitor) Updates() <-chan State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch := make(chan State, 1)
+	if m.closed {
+		close(ch)
+		return ch
+	}
+	ch <- m.activeState()
+	m.subs = append(m.subs, ch)
+	return ch
+}
+
+// Active returns the state of the active player.
+func (m *Monitor) Active() (State, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.players[m.active]; ok {
+		return *p, true
+	}
+	return State{Status: StatusStopped}, false
+}
+
+// activeState returns the state of the active player, or an empty state if
+// there is none. It must be called with the lock held.
+func (m *Monitor) activeState() State {
+	if p, ok := m.players[m.active]; ok {
+		return *p
+	}
+	return State{Status: StatusStopped}
+}
+
+// close stops sending updates and closes every updates channel.
+func (m *Monitor) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	for _, ch := range m.subs {
+		close(ch)
+	}
+	m.subs = nil
+}
+
+// PlayPause toggles playback of the active player.
+func (m *Monitor) PlayPause(ctx context.Context) error {
+	return m.call(ctx, "PlayPause")
+}
+
+// Next skips to the next track of the active player.
+func (m *Monitor) Next(ctx context.Context) error {
+	return m.call(ctx, "Next")
+}
+
+// Previous skips to the previous track of the active player.
+func (m *Monitor) Previous(ctx context.Context) error {
+	return m.call(ctx, "Previous")
+}
+
+// SetPosition seeks the current track of the active player to the given
+// position.
+func (m *Monitor) SetPosition(ctx context.Context, position time.Duration) error {
+	state, ok := m.Active()
+	if !ok {
+		return ErrNoPlayer
+	}
+	if state.trackID == "" {
+		return errors.New("active player has no track")
+	}
+	return m.call(ctx, "SetPosition", state.trackID, position.Microseconds())
+}
+
+// SetVolume sets the volume of the active player, between 0 and 1.
+func (m *Monitor) SetVolume(ctx context.Context, volume float64) error {
+	state, ok := m.Active()
+	if !ok {
+		return ErrNoPlayer
+	}
+	return dbusx.NewBusRequest(ctx, dbusx.SessionBus).
+		Path(mprisPath).
+		Destination(state.Player).
+		SetProp(mprisPlayerInterface+".Volume", dbus.MakeVariant(min(max(volume, 0), 1)))
+}
+
+func (m *Monitor) call(ctx context.Context, method string, args ...any) error {
+	state, ok := m.Active()
+	if !ok {
+		return ErrNoPlayer
+	}
+	return dbusx.NewBusRequest(ctx, dbusx.SessionBus).
+		Path(mprisPath).
+		Destination(state.Player).
+		Call(mprisPlayerInterface+"."+method, args...)
+}
+
+// addPlayer fetches the state of the player with the given name and starts
+// tracking it.
+func (m *Monitor) addPlayer(ctx context.Context, name, owner string) {
+	if owner == "" {
+		owner, _ = dbusx.NewBusRequest(ctx, dbusx.SessionBus).
+			Path(dbusPath).
+			Destination(dbusDest).
+			GetData(dbusGetNameOwnerMethod, name).
+			AsRawInterface().(string)
+	}
+	state := &State{
+		Player: name,
+		Status: StatusStopped,
+	}
+	if identity, err := getProp(ctx, name, mprisInterface+".Identity"); err == nil {
+		state.Identity = dbusx.VariantToValue[string](identity)
+	}
+	props := make(map[string]dbus.Variant)
+	for _, prop := range []string{"PlaybackStatus", "Metadata", "Position", "Volume"} {
+		if v, err := getProp(ctx, name, mprisPlayerInterface+"."+prop); err == nil {
+			props[prop] = v
+		}
+	}
+	state.update(props)
+	log.Debug().Str("player", name).Msg("Media player added.")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.players[name] = state
+	if owner != "" {
+		m.owners[owner] = name
+	}
+	if m.active == "" || state.Status == StatusPlaying {
+		m.active = name
+	}
+	m.notify()
+}
+
+// removePlayer stops tracking the player with the given name. If it was the
+// active player, another player is made active.
+func (m *Monitor) removePlayer(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.players, name)
+	for owner, n := range m.owners {
+		if n == name {
+			delete(m.owners, owner)
+		}
+	}
+	log.Debug().Str("player", name).Msg("Media player removed.")
+	if m.active != name {
+		return
+	}
+	m.active = ""
+	for n, p := range m.players {
+		if m.active == "" || p.Status == StatusPlaying {
+			m.active = n
+		}
+	}
+	m.notify()
+}
+
+// updatePlayer updates the state of the player owned by the given unique bus
+// name with the given changed properties.
+func (m *Monitor) updatePlayer(ctx context.Context, owner string, props map[string]dbus.Variant) {
+	m.mu.Lock()
+	name, ok := m.owners[owner]
+	m.mu.Unlock()
+	if !ok {
+		return
+	}
+	// Players do not always include the position when the track or status
+	// changes, so fetch it.
+	if _, ok := props["Position"]; !ok {
+		if v, err := getProp(ctx, name, mprisPlayerInterface+".Position"); err == nil {
+			props["Position"] = v
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.players[name]
+	if !ok {
+		return
+	}
+	wasPlaying := state.Status == StatusPlaying
+	state.update(props)
+	switch {
+	case state.Status == StatusPlaying && !wasPlaying:
+		// A player that starts playing becomes the active player.
+		m.active = name
+	case m.players[m.active] == nil || m.players[m.active].Status != StatusPlaying:
+		// Otherwise, only take over from an active player that is not
+		// playing.
+		m.active = name
+	}
+	if m.active == name {
+		m.notify()
+	}
+}
+
+// refreshPosition fetches the position of the active player if it is playing.
+func (m *Monitor) refreshPosition(ctx context.Context) {
+	state, ok := m.Active()
+	if !ok || state.Status != StatusPlaying {
+		return
+	}
+	v, err := getProp(ctx, state.Player, mprisPlayerInterface+".Position")
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p, ok := m.players[state.Player]; ok && m.active == state.Player {
+		p.update(map[string]dbus.Variant{"Position": v})
+		m.notify()
+	}
+}
+
+// notify sends the state of the active player on every updates channel,
+// replacing any state not yet read. It must be called with the lock held.
+func (m *Monitor) notify() {
+	if m.closed {
+		return
+	}
+	state := m.activeState()
+	for _, ch := range m.subs {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- state
+	}
+}
+
+// update sets the state from the given (changed) MPRIS player properties.
+func (s *State) update(props map[string]dbus.Variant) {
+	for prop, value := range props {
+		switch prop {
+		case "PlaybackStatus":
+			s.Status = dbusx.VariantToValue[string](value)
+		case "Metadata":
+			s.updateMetadata(dbusx.VariantToValue[map[string]dbus.Variant](value))
+		case "Position":
+			s.Position = microseconds(value)
+		case "Volume":
+			s.Volume = dbusx.VariantToValue[float64](value)
+		}
+	}
+}
+
+// updateMetadata sets the track details of the state from the given MPRIS
+// metadata.
+func (s *State) updateMetadata(metadata map[string]dbus.Variant) {
+	s.trackID = ""
+	s.Title, s.Artist, s.Album = "", "", ""
+	s.Length = 0
+	for key, value := range metadata {
+		switch key {
+		case "mpris:trackid":
+			s.trackID = dbusx.VariantToValue[dbus.ObjectPath](value)
+		case "xesam:title":
+			s.Title = dbusx.VariantToValue[string](value)
+		case "xesam:artist":
+			s.Artist = strings.Join(dbusx.VariantToValue[[]string](value), ", ")
+		case "xesam:album":
+			s.Album = dbusx.VariantToValue[string](value)
+		case "mpris:length":
+			s.Length = microseconds(value)
+		}
+	}
+}
+
+// microseconds converts a D-Bus time value in microseconds to a duration.
+// Players use a variety of integer types for these values.
+func microseconds(value dbus.Variant) time.Duration {
+	switch v := value.Value().(type) {
+	case int64:
+		return time.Duration(v) * time.Microsecond
+	case uint64:
+		return time.Duration(v) * time.Microsecond
+	case int32:
+		return time.Duration(v) * time.Microsecond
+	case uint32:
+		return time.Duration(v) * time.Microsecond
+	case float64:
+		return time.Duration(v) * time.Microsecond
+	default:
+		return 0
+	}
+}
+
+func getProp(ctx context.Context, dest, prop string) (dbus.Variant, error) {
+	return dbusx.NewBusRequest(ctx, dbusx.SessionBus).
+		Path(mprisPath).
+		Destination(dest).
+		GetProp(prop)
+}
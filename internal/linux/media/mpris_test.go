@@ -0,0 +1,145 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package media
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestState_update(t *testing.T) {
+	metadata := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/org/mpris/MediaPlayer2/Track/1")),
+		"mpris:length":  dbus.MakeVariant(int64(215000000)),
+		"xesam:title":   dbus.MakeVariant("Song"),
+		"xesam:artist":  dbus.MakeVariant([]string{"Artist One", "Artist Two"}),
+		"xesam:album":   dbus.MakeVariant("Album"),
+	}
+	tests := []struct {
+		state *State
+		props map[string]dbus.Variant
+		want  State
+		name  string
+	}{
+		{
+			name:  "all properties",
+			state: &State{Player: "org.mpris.MediaPlayer2.test"},
+			props: map[string]dbus.Variant{
+				"PlaybackStatus": dbus.MakeVariant(StatusPlaying),
+				"Metadata":       dbus.MakeVariant(metadata),
+				"Position":       dbus.MakeVariant(int64(30500000)),
+				"Volume":         dbus.MakeVariant(0.5),
+			},
+			want: State{
+				Player:   "org.mpris.MediaPlayer2.test",
+				Status:   StatusPlaying,
+				Title:    "Song",
+				Artist:   "Artist One, Artist Two",
+				Album:    "Album",
+				trackID:  "/org/mpris/MediaPlayer2/Track/1",
+				Position: 30500 * time.Millisecond,
+				Length:   215 * time.Second,
+				Volume:   0.5,
+			},
+		},
+		{
+			name:  "unsigned length",
+			state: &State{},
+			props: map[string]dbus.Variant{
+				"Metadata": dbus.MakeVariant(map[string]dbus.Variant{
+					"mpris:length": dbus.MakeVariant(uint64(60000000)),
+				}),
+			},
+			want: State{Length: time.Minute},
+		},
+		{
+			name:  "new track clears old metadata",
+			state: &State{Status: StatusPaused, Title: "Old", Artist: "Old", Album: "Old", Length: time.Minute},
+			props: map[string]dbus.Variant{
+				"Metadata": dbus.MakeVariant(map[string]dbus.Variant{
+					"xesam:title": dbus.MakeVariant("New"),
+				}),
+			},
+			want: State{Status: StatusPaused, Title: "New"},
+		},
+		{
+			name:  "unchanged properties are kept",
+			state: &State{Status: StatusPlaying, Title: "Song", Volume: 1},
+			props: map[string]dbus.Variant{
+				"PlaybackStatus": dbus.MakeVariant(StatusPaused),
+			},
+			want: State{Status: StatusPaused, Title: "Song", Volume: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.state.update(tt.props)
+			if !reflect.DeepEqual(*tt.state, tt.want) {
+				t.Errorf("State.update() = %+v, want %+v", *tt.state, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonitor_Updates(t *testing.T) {
+	m := &Monitor{
+		players: map[string]*State{"player": {Player: "player", Status: StatusPlaying}},
+		owners:  make(map[string]string),
+	}
+	first, second := m.Updates(), m.Updates()
+
+	// Each channel is sent the current state.
+	for _, ch := range []<-chan State{first, second} {
+		if got := <-ch; got.Status != StatusStopped {
+			t.Errorf("Monitor.Updates() = %v, want no active player", got)
+		}
+	}
+
+	// Each channel is sent the latest state when it changes.
+	m.mu.Lock()
+	m.active = "player"
+	m.notify()
+	m.players["player"].Title = "Song"
+	m.notify()
+	m.mu.Unlock()
+	for _, ch := range []<-chan State{first, second} {
+		if got := <-ch; got.Title != "Song" {
+			t.Errorf("Monitor.Updates() = %v, want latest state", got)
+		}
+	}
+
+	// Every channel is closed when the monitor stops.
+	m.close()
+	for _, ch := range []<-chan State{first, second, m.Updates()} {
+		if _, ok := <-ch; ok {
+			t.Error("Monitor.Updates() channel not closed")
+		}
+	}
+}
+
+func TestMonitorFromContext(t *testing.T) {
+	ctx := Setup(context.TODO())
+	want := &Monitor{}
+	shared, ok := ctx.Value(monitorCtxKey{}).(*sharedMonitor)
+	if !ok {
+		t.Fatal("Setup() did not share a monitor")
+	}
+	shared.once.Do(func() { shared.monitor = want })
+
+	for range 2 {
+		got, err := MonitorFromContext(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("MonitorFromContext() = %p, want shared monitor %p", got, want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package media
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+type mediaSensor struct {
+	linux.Sensor
+	player   string
+	identity string
+	length   int
+}
+
+type mediaSensorAttributes struct {
+	DataSource string `json:"Data Source"`
+	Player     string `json:"Player,omitempty"`
+	Identity   string `json:"Identity,omitempty"`
+	Length     int    `json:"Length,omitempty"`
+}
+
+func (s *mediaSensor) Attributes() any {
+	return &mediaSensorAttributes{
+		DataSource: linux.DataSrcDbus,
+		Player:     s.player,
+		Identity:   s.identity,
+		Length:     s.length,
+	}
+}
+
+func newMediaSensor(t linux.SensorTypeValue, icon string, state State) *mediaSensor {
+	s := &mediaSensor{
+		player:   state.Player,
+		identity: state.Identity,
+	}
+	s.SensorTypeValue = t
+	s.IconString = icon
+	s.SensorSrc = linux.DataSrcDbus
+	return s
+}
+
+// newMediaSensors returns the sensors for the given state of the active media
+// player.
+func newMediaSensors(state State) []*mediaSensor {
+	status := newMediaSensor(linux.SensorMediaState, "mdi:play-pause", state)
+	status.Value = state.Status
+	switch state.Status {
+	case StatusPlaying:
+		status.IconString = "mdi:play"
+	case StatusPaused:
+		status.IconString = "mdi:pause"
+	case StatusStopped:
+		status.IconString = "mdi:stop"
+	}
+
+	title := newMediaSensor(linux.SensorMediaTitle, "mdi:music", state)
+	title.Value = state.Title
+
+	artist := newMediaSensor(linux.SensorMediaArtist, "mdi:account-music", state)
+	artist.Value = state.Artist
+
+	album := newMediaSensor(linux.SensorMediaAlbum, "mdi:album", state)
+	album.Value = state.Album
+
+	position := newMediaSensor(linux.SensorMediaPosition, "mdi:timer-music", state)
+	position.Value = int(state.Position.Seconds())
+	position.length = int(state.Length.Seconds())
+	position.UnitsString = "s"
+	position.DeviceClassValue = sensor.Duration
+
+	return []*mediaSensor{status, title, artist, album, position}
+}
+
+// Updater reports the playback status, track details and position of the most
+// recently active MPRIS media player.
+func Updater(ctx context.Context) chan tracker.Sensor {
+	sensorCh := make(chan tracker.Sensor)
+	monitor, err := MonitorFromContext(ctx)
+	if err != nil {
+		log.Debug().Err(err).Msg("Could not monitor media players. Media sensors will not run.")
+		close(sensorCh)
+		return sensorCh
+	}
+	go func() {
+		defer close(sensorCh)
+		for state := range monitor.Updates() {
+			for _, s := range newMediaSensors(state) {
+				select {
+				case <-ctx.Done():
+					return
+				case sensorCh <- s:
+				}
+			}
+		}
+		log.Debug().Msg("Stopped media sensors.")
+	}()
+	return sensorCh
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package net
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/joshuar/go-hass-agent/internal/linux"
+)
+
+var (
+	// defaultExcludedInterfaces are the interfaces not reported if no
+	// exclude patterns are set in the preferences.
+	defaultExcludedInterfaces = []string{"lo", "veth*", "docker*"}
+	// vpnInterfaces are the patterns of VPN interfaces, which are reported
+	// along with physical interfaces if no include patterns are set in the
+	// preferences.
+	vpnInterfaces = []string{"tun*", "tap*", "wg*", "ppp*", "ipsec*"}
+)
+
+// ifaceFilter chooses the network interfaces that have their own sensors.
+type ifaceFilter struct {
+	include []string
+	exclude []string
+}
+
+func newIfaceFilter(include, exclude []string) *ifaceFilter {
+	if exclude == nil {
+		exclude = defaultExcludedInterfaces
+	}
+	return &ifaceFilter{include: include, exclude: exclude}
+}
+
+// match returns whether the interface with the given name should be reported.
+func (f *ifaceFilter) match(name string) bool {
+	if linux.MatchAny(f.exclude, name) {
+		return false
+	}
+	if len(f.include) > 0 {
+		return linux.MatchAny(f.include, name)
+	}
+	return isPhysical(name) || linux.MatchAny(vpnInterfaces, name)
+}
+
+// link is the state of a network interface, as reported by sysfs.
+type link struct {
+	// state is the operational state (e.g., up, down or dormant).
+	state string
+	// speed is the link speed in Mbit/s, or -1 if it is unknown (e.g., for
+	// wireless or virtual interfaces or when the link is down).
+	speed int
+}
+
+// getLink returns the state of the interface with the given name.
+func getLink(name string) *link {
+	l := &link{speed: -1}
+	dir := ifacePath(name)
+	l.state = linux.ReadString(filepath.Join(dir, "operstate"))
+	if speed, err := strconv.Atoi(linux.ReadString(filepath.Join(dir, "speed"))); err == nil && speed > 0 {
+		l.speed = speed
+	}
+	return l
+}
+
+// isPhysical returns whether the interface with the given name is backed by a
+// device (i.e., it is not virtual).
+func isPhysical(name string) bool {
+	_, err := os.Stat(filepath.Join(ifacePath(name), "device"))
+	return err == nil
+}
+
+// ifaceID converts an interface name into a form that can be used in IDs
+// (e.g., eth0.100 becomes eth0_100).
+func ifaceID(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, name)
+}
+
+func ifacePath(name string) string {
+	return filepath.Join(linux.SysfsRoot(), "class", "net", name)
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package net
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/joshuar/go-hass-agent/internal/linux"
+)
+
+// newFakeIface creates a network interface in a fake sysfs tree at root. If
+// physical is true, the interface is backed by a device. Any file with an
+// empty value is not created.
+func newFakeIface(t *testing.T, root, name string, physical bool, files map[string]string) {
+	t.Helper()
+	path := filepath.Join(root, "class", "net", name)
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if physical {
+		if err := os.MkdirAll(filepath.Join(path, "device"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, value := range files {
+		if value == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(path, file), []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_ifaceFilter_match(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv(linux.SysfsEnv, root)
+	for _, name := range []string{"eth0", "wlp3s0", "docker0"} {
+		newFakeIface(t, root, name, true, nil)
+	}
+	for _, name := range []string{"lo", "veth1a2b", "br-1234", "wg0", "tun0"} {
+		newFakeIface(t, root, name, false, nil)
+	}
+
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{
+			name: "defaults",
+			want: []string{"eth0", "wlp3s0", "wg0", "tun0"},
+		},
+		{
+			name:    "include patterns",
+			include: []string{"wl*", "br-*", "lo"},
+			want:    []string{"wlp3s0", "br-1234"},
+		},
+		{
+			name:    "exclude patterns",
+			exclude: []string{"wg*"},
+			want:    []string{"eth0", "wlp3s0", "docker0", "tun0"},
+		},
+		{
+			name:    "include and exclude patterns",
+			include: []string{"*"},
+			exclude: []string{"lo", "veth*", "[bad"},
+			want:    []string{"eth0", "wlp3s0", "docker0", "br-1234", "wg0", "tun0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newIfaceFilter(tt.include, tt.exclude)
+			var got []string
+			for _, name := range []string{"lo", "eth0", "wlp3s0", "docker0", "veth1a2b", "br-1234", "wg0", "tun0"} {
+				if f.match(name) {
+					got = append(got, name)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_getLink(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv(linux.SysfsEnv, root)
+	newFakeIface(t, root, "eth0", true, map[string]string{"operstate": "up", "speed": "1000"})
+	newFakeIface(t, root, "eth1", true, map[string]string{"operstate": "down", "speed": "-1"})
+	newFakeIface(t, root, "wlan0", true, map[string]string{"operstate": "dormant"})
+
+	assert.Equal(t, &link{state: "up", speed: 1000}, getLink("eth0"))
+	assert.Equal(t, &link{state: "down", speed: -1}, getLink("eth1"))
+	assert.Equal(t, &link{state: "dormant", speed: -1}, getLink("wlan0"))
+	assert.Equal(t, &link{speed: -1}, getLink("missing0"))
+}
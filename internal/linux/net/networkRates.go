@@ -9,12 +9,14 @@ import (
 	"context"
 	"time"
 
+	"github.com/iancoleman/strcase"
 	"github.com/rs/zerolog/log"
 	"github.com/shirou/gopsutil/v3/net"
 
 	"github.com/joshuar/go-hass-agent/internal/device/helpers"
 	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
 	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/preferences"
 	"github.com/joshuar/go-hass-agent/internal/tracker"
 )
 
@@ -26,10 +28,19 @@ type netIOSensorAttributes struct {
 }
 
 type netIOSensor struct {
+	iface string
 	linux.Sensor
 	netIOSensorAttributes
 }
 
+func (s *netIOSensor) Name() string {
+	return ifaceSensorName(s.iface, s.SensorTypeValue)
+}
+
+func (s *netIOSensor) ID() string {
+	return ifaceSensorID(s.iface, s.SensorTypeValue)
+}
+
 func (s *netIOSensor) Attributes() any {
 	return struct {
 		NativeUnit string `json:"native_unit_of_measurement"`
@@ -69,8 +80,9 @@ func (s *netIOSensor) update(c *net.IOCountersStat) {
 	}
 }
 
-func newNetIOSensor(t linux.SensorTypeValue) *netIOSensor {
+func newNetIOSensor(t linux.SensorTypeValue, iface string) *netIOSensor {
 	return &netIOSensor{
+		iface: iface,
 		Sensor: linux.Sensor{
 			UnitsString:      "B",
 			SensorTypeValue:  t,
@@ -81,10 +93,19 @@ func newNetIOSensor(t linux.SensorTypeValue) *netIOSensor {
 }
 
 type netIORateSensor struct {
+	iface string
 	linux.Sensor
 	lastValue uint64
 }
 
+func (s *netIORateSensor) Name() string {
+	return ifaceSensorName(s.iface, s.SensorTypeValue)
+}
+
+func (s *netIORateSensor) ID() string {
+	return ifaceSensorID(s.iface, s.SensorTypeValue)
+}
+
 func (s *netIORateSensor) Icon() string {
 	switch s.SensorTypeValue {
 	case linux.SensorBytesRecvRate:
@@ -96,14 +117,16 @@ func (s *netIORateSensor) Icon() string {
 }
 
 func (s *netIORateSensor) update(d time.Duration, b uint64) {
-	if uint64(d.Seconds()) > 0 && s.lastValue != 0 {
+	// Counters are reset if an interface is removed and added again.
+	if uint64(d.Seconds()) > 0 && s.lastValue != 0 && b >= s.lastValue {
 		s.Value = (b - s.lastValue) / uint64(d.Seconds())
 	}
 	s.lastValue = b
 }
 
-func newNetIORateSensor(t linux.SensorTypeValue) *netIORateSensor {
+func newNetIORateSensor(t linux.SensorTypeValue, iface string) *netIORateSensor {
 	return &netIORateSensor{
+		iface: iface,
 		Sensor: linux.Sensor{
 			UnitsString:      "B/s",
 			SensorTypeValue:  t,
@@ -114,12 +137,151 @@ func newNetIORateSensor(t linux.SensorTypeValue) *netIORateSensor {
 	}
 }
 
+type linkSensor struct {
+	iface string
+	// gone is whether the interface has been removed, in which case the
+	// sensor is unavailable.
+	gone bool
+	linux.Sensor
+}
+
+func (s *linkSensor) Name() string {
+	return ifaceSensorName(s.iface, s.SensorTypeValue)
+}
+
+func (s *linkSensor) ID() string {
+	return ifaceSensorID(s.iface, s.SensorTypeValue)
+}
+
+func (s *linkSensor) Icon() string {
+	if s.SensorTypeValue == linux.SensorLinkSpeed {
+		return "mdi:speedometer"
+	}
+	if s.Value == "up" {
+		return "mdi:lan-connect"
+	}
+	return "mdi:lan-disconnect"
+}
+
+func (s *linkSensor) Available() bool {
+	return !s.gone
+}
+
+func newLinkSensors(iface string, l *link) []tracker.Sensor {
+	speed := &linkSensor{iface: iface}
+	speed.SensorTypeValue = linux.SensorLinkSpeed
+	speed.SensorSrc = linux.DataSrcSysfs
+	speed.UnitsString = "Mbit/s"
+	speed.DeviceClassValue = sensor.Data_rate
+	speed.StateClassValue = sensor.StateMeasurement
+	speed.Value = l.speed
+	if l.speed < 0 {
+		speed.Value = sensor.StateUnknown
+	}
+
+	state := &linkSensor{iface: iface}
+	state.SensorTypeValue = linux.SensorLinkState
+	state.SensorSrc = linux.DataSrcSysfs
+	state.Value = l.state
+
+	return []tracker.Sensor{speed, state}
+}
+
+// ifaceSensors are the sensors for a single network interface.
+type ifaceSensors struct {
+	bytesRx     *netIOSensor
+	bytesTx     *netIOSensor
+	bytesRxRate *netIORateSensor
+	bytesTxRate *netIORateSensor
+	link        *link
+	name        string
+}
+
+func newIfaceSensors(name string) *ifaceSensors {
+	return &ifaceSensors{
+		name:        name,
+		bytesRx:     newNetIOSensor(linux.SensorBytesRecv, name),
+		bytesTx:     newNetIOSensor(linux.SensorBytesSent, name),
+		bytesRxRate: newNetIORateSensor(linux.SensorBytesRecvRate, name),
+		bytesTxRate: newNetIORateSensor(linux.SensorBytesSentRate, name),
+	}
+}
+
+// update updates the sensors with the given counters and returns those to
+// send. The link sensors are only sent when the link changes.
+func (i *ifaceSensors) update(delta time.Duration, c *net.IOCountersStat) []tracker.Sensor {
+	i.bytesRx.update(c)
+	i.bytesTx.update(c)
+	i.bytesRxRate.update(delta, c.BytesRecv)
+	i.bytesTxRate.update(delta, c.BytesSent)
+	sensors := []tracker.Sensor{i.bytesRx, i.bytesTx, i.bytesRxRate, i.bytesTxRate}
+	if l := getLink(i.name); i.link == nil || *l != *i.link {
+		i.link = l
+		sensors = append(sensors, newLinkSensors(i.name, l)...)
+	}
+	return sensors
+}
+
+// removed returns the link sensors to send when the interface has been
+// removed. The link is down and the sensors are unavailable.
+func (i *ifaceSensors) removed() []tracker.Sensor {
+	sensors := newLinkSensors(i.name, &link{state: "down", speed: -1})
+	for _, s := range sensors {
+		if l, ok := s.(*linkSensor); ok {
+			l.gone = true
+		}
+	}
+	return sensors
+}
+
+// pruneIfaces removes the interfaces that are not in current from ifaces and
+// returns the sensors to send for them.
+func pruneIfaces(ifaces map[string]*ifaceSensors, current map[string]bool) []tracker.Sensor {
+	var sensors []tracker.Sensor
+	for name, i := range ifaces {
+		if current[name] {
+			continue
+		}
+		log.Debug().Str("interface", name).Msg("Network interface removed.")
+		sensors = append(sensors, i.removed()...)
+		delete(ifaces, name)
+	}
+	return sensors
+}
+
+// ifaceSensorName returns the name of a sensor of the given type for the given
+// interface. If the interface is empty, the sensor is for all interfaces.
+func ifaceSensorName(iface string, t linux.SensorTypeValue) string {
+	if iface == "" {
+		return t.String()
+	}
+	return iface + " " + t.String()
+}
+
+// ifaceSensorID returns the ID of a sensor of the given type for the given
+// interface. If the interface is empty, the sensor is for all interfaces.
+func ifaceSensorID(iface string, t linux.SensorTypeValue) string {
+	if iface == "" {
+		return strcase.ToSnake(t.String())
+	}
+	return ifaceID(iface) + "_" + strcase.ToSnake(t.String())
+}
+
+// RatesUpdater reports the bytes sent and received, and throughput, across all
+// network interfaces. It also reports them, along with the link speed and
+// state, for each interface chosen by the include and exclude patterns in the
+// preferences. When an interface is removed, its link state is sent as down and
+// its link sensors are marked unavailable.
 func RatesUpdater(ctx context.Context) chan tracker.Sensor {
 	sensorCh := make(chan tracker.Sensor, 2)
-	bytesRx := newNetIOSensor(linux.SensorBytesRecv)
-	bytesTx := newNetIOSensor(linux.SensorBytesSent)
-	bytesRxRate := newNetIORateSensor(linux.SensorBytesRecvRate)
-	bytesTxRate := newNetIORateSensor(linux.SensorBytesSentRate)
+	bytesRx := newNetIOSensor(linux.SensorBytesRecv, "")
+	bytesTx := newNetIOSensor(linux.SensorBytesSent, "")
+	bytesRxRate := newNetIORateSensor(linux.SensorBytesRecvRate, "")
+	bytesTxRate := newNetIORateSensor(linux.SensorBytesSentRate, "")
+
+	prefs := preferences.FetchFromContext(ctx)
+	filter := newIfaceFilter(prefs.Network.Include, prefs.Network.Exclude)
+	ifaces := make(map[string]*ifaceSensors)
 
 	sendNetStats := func(delta time.Duration) {
 		netIO, err := net.IOCountersWithContext(ctx, false)
@@ -138,6 +300,32 @@ func RatesUpdater(ctx context.Context) chan tracker.Sensor {
 		sensorCh <- bytesRxRate
 		bytesTxRate.update(delta, netIO[0].BytesSent)
 		sensorCh <- bytesTxRate
+
+		ifaceIO, err := net.IOCountersWithContext(ctx, true)
+		if err != nil {
+			log.Debug().Err(err).Caller().
+				Msg("Problem fetching network interface stats.")
+			return
+		}
+		current := make(map[string]bool)
+		for idx := range ifaceIO {
+			c := &ifaceIO[idx]
+			if !filter.match(c.Name) {
+				continue
+			}
+			current[c.Name] = true
+			i, ok := ifaces[c.Name]
+			if !ok {
+				i = newIfaceSensors(c.Name)
+				ifaces[c.Name] = i
+			}
+			for _, s := range i.update(delta, c) {
+				sensorCh <- s
+			}
+		}
+		for _, s := range pruneIfaces(ifaces, current) {
+			sensorCh <- s
+		}
 	}
 
 	go helpers.PollSensors(ctx, sendNetStats, 5*time.Second, time.Second*1)
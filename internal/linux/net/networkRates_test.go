@@ -0,0 +1,49 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package net
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+func Test_pruneIfaces(t *testing.T) {
+	ifaces := map[string]*ifaceSensors{
+		"eth0":  newIfaceSensors("eth0"),
+		"wlan0": newIfaceSensors("wlan0"),
+	}
+
+	sensors := pruneIfaces(ifaces, map[string]bool{"eth0": true})
+
+	// The removed interface is no longer tracked.
+	assert.Contains(t, ifaces, "eth0")
+	assert.NotContains(t, ifaces, "wlan0")
+
+	// Its link sensors are sent as down and unavailable.
+	if !assert.Len(t, sensors, 2) {
+		return
+	}
+	for _, s := range sensors {
+		l, ok := s.(*linkSensor)
+		if !assert.True(t, ok) {
+			continue
+		}
+		assert.Equal(t, "wlan0", l.iface)
+		a, ok := s.(tracker.Availability)
+		assert.True(t, ok)
+		assert.False(t, a.Available())
+		if l.SensorTypeValue == linux.SensorLinkState {
+			assert.Equal(t, "down", l.State())
+		}
+	}
+
+	// Nothing is sent once the interface has been removed.
+	assert.Empty(t, pruneIfaces(ifaces, map[string]bool{"eth0": true}))
+}
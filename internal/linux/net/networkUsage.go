@@ -0,0 +1,253 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package net
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/iancoleman/strcase"
+	"github.com/rs/zerolog/log"
+	"github.com/shirou/gopsutil/v3/net"
+
+	"github.com/joshuar/go-hass-agent/internal/device/helpers"
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+	"github.com/joshuar/go-hass-agent/pkg/linux/dbusx"
+)
+
+const (
+	usageStoreFile     = "network-usage.json"
+	usagePollInterval  = time.Minute
+	bootIDFile         = "/proc/sys/kernel/random/boot_id"
+	dbusNMDeviceIntr   = dBusNMObj + ".Device"
+	nmMeteredYes       = 1
+	nmMeteredGuessYes  = 3
+	meteredUnknownName = "unknown"
+)
+
+// nmMetered are the names of the NetworkManager NMMetered values.
+var nmMetered = []string{meteredUnknownName, "yes", "no", "guess yes", "guess no"}
+
+type usageSensor struct {
+	usage *usage
+	name  string
+	linux.Sensor
+}
+
+type usageSensorAttributes struct {
+	DataSource string `json:"Data Source"`
+	CycleStart string `json:"Cycle Start,omitempty"`
+	Received   uint64 `json:"Received"`
+	Sent       uint64 `json:"Sent"`
+}
+
+func (s *usageSensor) Name() string {
+	if conn, ok := strings.CutPrefix(s.name, connUsagePrefix); ok {
+		return conn + " Connection " + s.SensorTypeValue.String()
+	}
+	return strings.TrimPrefix(s.name, ifaceUsagePrefix) + " " + s.SensorTypeValue.String()
+}
+
+func (s *usageSensor) ID() string {
+	if conn, ok := strings.CutPrefix(s.name, connUsagePrefix); ok {
+		return "connection_" + ifaceID(conn) + "_" + strcase.ToSnake(s.SensorTypeValue.String())
+	}
+	return ifaceID(strings.TrimPrefix(s.name, ifaceUsagePrefix)) + "_" + strcase.ToSnake(s.SensorTypeValue.String())
+}
+
+func (s *usageSensor) Attributes() any {
+	attrs := &usageSensorAttributes{DataSource: linux.DataSrcProcfs}
+	var t traffic
+	switch s.SensorTypeValue {
+	case linux.SensorDataUsageToday:
+		t = s.usage.Today
+	case linux.SensorDataUsageMonth:
+		t = s.usage.Cycle
+		attrs.CycleStart = s.usage.CycleStart
+	default:
+		t = s.usage.Total
+	}
+	attrs.Received = t.Rx
+	attrs.Sent = t.Tx
+	return attrs
+}
+
+func newUsageSensors(name string, u *usage) []tracker.Sensor {
+	sensors := make([]tracker.Sensor, 0, 3)
+	for _, t := range []linux.SensorTypeValue{linux.SensorDataUsage, linux.SensorDataUsageToday, linux.SensorDataUsageMonth} {
+		// Copy the usage so it is not changed while the sensor is sent.
+		s := &usageSensor{name: name, usage: new(usage)}
+		*s.usage = *u
+		switch t {
+		case linux.SensorDataUsageToday:
+			s.Value = u.Today.Rx + u.Today.Tx
+		case linux.SensorDataUsageMonth:
+			s.Value = u.Cycle.Rx + u.Cycle.Tx
+		default:
+			s.Value = u.Total.Rx + u.Total.Tx
+		}
+		s.SensorTypeValue = t
+		s.SensorSrc = linux.DataSrcProcfs
+		s.IconString = "mdi:chart-box-outline"
+		s.UnitsString = "B"
+		s.DeviceClassValue = sensor.Data_size
+		s.StateClassValue = sensor.StateTotalIncreasing
+		sensors = append(sensors, s)
+	}
+	return sensors
+}
+
+type meteredSensor struct {
+	metered    string
+	connection string
+	linux.Sensor
+}
+
+type meteredSensorAttributes struct {
+	DataSource string `json:"Data Source"`
+	Metered    string `json:"Metered"`
+	Connection string `json:"Connection,omitempty"`
+}
+
+func (s *meteredSensor) Icon() string {
+	if s.Value == true {
+		return "mdi:cash"
+	}
+	return "mdi:cash-off"
+}
+
+func (s *meteredSensor) Attributes() any {
+	return &meteredSensorAttributes{
+		DataSource: linux.DataSrcDbus,
+		Metered:    s.metered,
+		Connection: s.connection,
+	}
+}
+
+func newMeteredSensor(metered uint32, connection string) *meteredSensor {
+	s := &meteredSensor{metered: meteredUnknownName, connection: connection}
+	if int(metered) < len(nmMetered) {
+		s.metered = nmMetered[metered]
+	}
+	s.Value = metered == nmMeteredYes || metered == nmMeteredGuessYes
+	s.IsBinary = true
+	s.SensorTypeValue = linux.SensorMetered
+	s.SensorSrc = linux.DataSrcDbus
+	return s
+}
+
+// getConnectionInterfaces returns the name of the active NetworkManager
+// connection each interface belongs to.
+func getConnectionInterfaces(ctx context.Context) map[string]string {
+	ifaces := make(map[string]string)
+	for _, path := range getActiveConnections(ctx) {
+		r := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+			Path(path).
+			Destination(dBusNMObj)
+		v, err := r.GetProp(dbusNMActiveConnIntr + ".Id")
+		if err != nil {
+			continue
+		}
+		name := dbusx.VariantToValue[string](v)
+		v, err = r.GetProp(dbusNMActiveConnIntr + ".Devices")
+		if err != nil {
+			continue
+		}
+		for _, device := range dbusx.VariantToValue[[]dbus.ObjectPath](v) {
+			v, err := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+				Path(device).
+				Destination(dBusNMObj).
+				GetProp(dbusNMDeviceIntr + ".Interface")
+			if err != nil {
+				continue
+			}
+			ifaces[dbusx.VariantToValue[string](v)] = name
+		}
+	}
+	return ifaces
+}
+
+// getMetered returns whether NetworkManager considers the primary connection
+// metered, and the name of that connection.
+func getMetered(ctx context.Context) (uint32, string, error) {
+	r := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Path(dBusNMPath).
+		Destination(dBusNMObj)
+	v, err := r.GetProp(dBusNMObj + ".Metered")
+	if err != nil {
+		return 0, "", err
+	}
+	metered := dbusx.VariantToValue[uint32](v)
+	var name string
+	if v, err := r.GetProp(dBusNMObj + ".PrimaryConnection"); err == nil {
+		if path := dbusx.VariantToValue[dbus.ObjectPath](v); path != "/" {
+			if v, err := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+				Path(path).
+				Destination(dBusNMObj).
+				GetProp(dbusNMActiveConnIntr + ".Id"); err == nil {
+				name = dbusx.VariantToValue[string](v)
+			}
+		}
+	}
+	return metered, name, nil
+}
+
+// UsageUpdater reports the data used by each interface chosen by the include
+// and exclude patterns in the preferences, and by each NetworkManager
+// connection, in total, today and in the current billing cycle. Usage is saved
+// to disk so it is kept across restarts and reboots. It also reports whether
+// the primary connection is metered.
+func UsageUpdater(ctx context.Context) chan tracker.Sensor {
+	sensorCh := make(chan tracker.Sensor)
+	prefs := preferences.FetchFromContext(ctx)
+	filter := newIfaceFilter(prefs.Network.Include, prefs.Network.Exclude)
+	billingDay := prefs.Network.BillingDay
+
+	store, err := loadUsageStore(filepath.Join(preferences.GetStatePath(), usageStoreFile))
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not load network usage. Usage will be counted from now.")
+	}
+	bootID := linux.ReadString(bootIDFile)
+
+	var lastMetered *meteredSensor
+	sendUsage := func(_ time.Duration) {
+		counters, err := net.IOCountersWithContext(ctx, true)
+		if err != nil {
+			log.Debug().Err(err).Msg("Problem fetching network interface stats.")
+			return
+		}
+		for _, key := range store.update(time.Now(), bootID, billingDay, counters, filter, getConnectionInterfaces(ctx)) {
+			for _, s := range newUsageSensors(key, store.Usage[key]) {
+				sensorCh <- s
+			}
+		}
+		if err := store.save(); err != nil {
+			log.Warn().Err(err).Msg("Could not save network usage.")
+		}
+
+		if metered, conn, err := getMetered(ctx); err == nil {
+			s := newMeteredSensor(metered, conn)
+			if lastMetered == nil || s.metered != lastMetered.metered || s.connection != lastMetered.connection {
+				lastMetered = s
+				sensorCh <- s
+			}
+		}
+	}
+
+	go helpers.PollSensors(ctx, sendUsage, usagePollInterval, time.Second*5)
+	go func() {
+		defer close(sensorCh)
+		<-ctx.Done()
+		log.Debug().Msg("Stopped network usage sensors.")
+	}()
+	return sensorCh
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package net
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+const dateFormat = "2006-01-02"
+
+// Prefixes of the keys of the usage store, which holds usage for both
+// interfaces and NetworkManager connections.
+const (
+	ifaceUsagePrefix = "interface/"
+	connUsagePrefix  = "connection/"
+)
+
+// traffic is a count of bytes received and sent.
+type traffic struct {
+	Rx uint64 `json:"rx"`
+	Tx uint64 `json:"tx"`
+}
+
+func (t traffic) add(o traffic) traffic {
+	return traffic{Rx: t.Rx + o.Rx, Tx: t.Tx + o.Tx}
+}
+
+// usage is the data used by an interface or connection: in total (since it was
+// first seen), today and in the current billing cycle.
+type usage struct {
+	Day        string  `json:"day"`
+	CycleStart string  `json:"cycle_start"`
+	Total      traffic `json:"total"`
+	Today      traffic `json:"today"`
+	Cycle      traffic `json:"cycle"`
+}
+
+// roll resets the daily and cycle usage if the day or billing cycle has
+// changed since it was last updated.
+func (u *usage) roll(now time.Time, billingDay int) {
+	if day := now.Format(dateFormat); u.Day != day {
+		u.Day = day
+		u.Today = traffic{}
+	}
+	if start := cycleStart(now, billingDay).Format(dateFormat); u.CycleStart != start {
+		u.CycleStart = start
+		u.Cycle = traffic{}
+	}
+}
+
+func (u *usage) add(t traffic) {
+	u.Total = u.Total.add(t)
+	u.Today = u.Today.add(t)
+	u.Cycle = u.Cycle.add(t)
+}
+
+// cycleStart returns the start of the billing cycle, beginning on the given day
+// of the month, that the given time is in.
+func cycleStart(now time.Time, billingDay int) time.Time {
+	if billingDay < 1 {
+		billingDay = 1
+	}
+	start := time.Date(now.Year(), now.Month(), billingDay, 0, 0, 0, 0, now.Location())
+	if now.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+// usageStore accounts for the data used by each interface and connection. It is
+// saved to disk so that usage is kept across agent restarts and reboots, when
+// the kernel counters are reset.
+type usageStore struct {
+	// Counters are the last kernel counters seen for each interface.
+	Counters map[string]traffic `json:"counters"`
+	Usage    map[string]*usage  `json:"usage"`
+	// BootID identifies the boot in which the counters were seen.
+	BootID string `json:"boot_id"`
+	path   string
+	// created is whether the store was newly created, rather than loaded
+	// from disk, and has not been updated yet.
+	created bool
+}
+
+// loadUsageStore loads the usage store saved at the given path. If there is no
+// saved store, or it cannot be read, an empty one is returned.
+func loadUsageStore(path string) (*usageStore, error) {
+	s := &usageStore{
+		path:     path,
+		Counters: make(map[string]traffic),
+		Usage:    make(map[string]*usage),
+		created:  true,
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return s, err
+	}
+	s.created = false
+	if s.Counters == nil {
+		s.Counters = make(map[string]traffic)
+	}
+	if s.Usage == nil {
+		s.Usage = make(map[string]*usage)
+	}
+	return s, nil
+}
+
+// save writes the store to disk, replacing any previously saved store.
+func (s *usageStore) save() error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// update accounts for the data used since the last update, as shown by the
+// given kernel counters, adding it to the usage of each interface that matches
+// the filter and of the connection (if any) that the interface belongs to. It
+// returns the keys of the usage that was updated.
+func (s *usageStore) update(now time.Time, bootID string, billingDay int, counters []net.IOCountersStat, filter *ifaceFilter, connections map[string]string) []string {
+	// Counters start from zero after a reboot.
+	rebooted := s.BootID != bootID
+	s.BootID = bootID
+	// When the store is first updated, the data already used by the
+	// interfaces was used before it was created, so their counters are only
+	// taken as a baseline.
+	baseline := s.created
+	s.created = false
+
+	updated := make(map[string]bool)
+	seen := make(map[string]traffic, len(counters))
+	for _, c := range counters {
+		current := traffic{Rx: c.BytesRecv, Tx: c.BytesSent}
+		seen[c.Name] = current
+		if !filter.match(c.Name) {
+			continue
+		}
+		last, ok := s.Counters[c.Name]
+		switch {
+		case baseline:
+			last = current
+		case rebooted || !ok:
+			// Interfaces added since boot or the last update also start
+			// from zero.
+			last = traffic{}
+		}
+		used := traffic{Rx: delta(last.Rx, current.Rx), Tx: delta(last.Tx, current.Tx)}
+
+		keys := []string{ifaceUsagePrefix + c.Name}
+		if conn, ok := connections[c.Name]; ok {
+			keys = append(keys, connUsagePrefix+conn)
+		}
+		for _, key := range keys {
+			u, ok := s.Usage[key]
+			if !ok {
+				u = &usage{}
+				s.Usage[key] = u
+			}
+			u.roll(now, billingDay)
+			u.add(used)
+			updated[key] = true
+		}
+	}
+	s.Counters = seen
+
+	// Usage that is not updated still rolls over to a new day or cycle.
+	for key, u := range s.Usage {
+		if updated[key] {
+			continue
+		}
+		day, cycle := u.Day, u.CycleStart
+		u.roll(now, billingDay)
+		if u.Day != day || u.CycleStart != cycle {
+			updated[key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(updated))
+	for key := range updated {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// delta returns the increase from the last to the current value of a counter.
+// If the counter has gone backwards, it was reset (e.g., the interface was
+// removed and added again) and the current value is the increase.
+func delta(last, current uint64) uint64 {
+	if current < last {
+		return current
+	}
+	return current - last
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package net
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_cycleStart(t *testing.T) {
+	tests := []struct {
+		name       string
+		now        string
+		want       string
+		billingDay int
+	}{
+		{name: "default", now: "2024-03-15", billingDay: 0, want: "2024-03-01"},
+		{name: "after billing day", now: "2024-03-20", billingDay: 15, want: "2024-03-15"},
+		{name: "on billing day", now: "2024-03-15", billingDay: 15, want: "2024-03-15"},
+		{name: "before billing day", now: "2024-03-10", billingDay: 15, want: "2024-02-15"},
+		{name: "across year", now: "2024-01-05", billingDay: 28, want: "2023-12-28"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.ParseInLocation(dateFormat, tt.now, time.Local)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, cycleStart(now.Add(12*time.Hour), tt.billingDay).Format(dateFormat))
+		})
+	}
+}
+
+func Test_usageStore_update(t *testing.T) {
+	counters := func(rx, tx uint64) []net.IOCountersStat {
+		return []net.IOCountersStat{
+			{Name: "eth0", BytesRecv: rx, BytesSent: tx},
+			{Name: "lo", BytesRecv: 1000, BytesSent: 1000},
+		}
+	}
+	day1 := time.Date(2024, 3, 14, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	filter := newIfaceFilter([]string{"eth*"}, nil)
+	conns := map[string]string{"eth0": "Office"}
+
+	path := filepath.Join(t.TempDir(), usageStoreFile)
+	s, err := loadUsageStore(path)
+	assert.Nil(t, err)
+
+	// The counters seen when the store is created are a baseline; data used
+	// before then is not counted.
+	keys := s.update(day1, "boot1", 15, counters(100, 10), filter, conns)
+	slices.Sort(keys)
+	assert.Equal(t, []string{"connection/Office", "interface/eth0"}, keys)
+	assert.Equal(t, traffic{}, s.Usage["interface/eth0"].Today)
+
+	// Only the increase is counted, including for the connection.
+	s.update(day1.Add(time.Minute), "boot1", 15, counters(150, 30), filter, conns)
+	assert.Equal(t, traffic{Rx: 50, Tx: 20}, s.Usage["interface/eth0"].Today)
+	assert.Equal(t, traffic{Rx: 50, Tx: 20}, s.Usage["connection/Office"].Today)
+
+	// An interface that appears after the store was created is counted from
+	// zero.
+	s.update(day1.Add(2*time.Minute), "boot1", 15,
+		append(counters(150, 30), net.IOCountersStat{Name: "eth1", BytesRecv: 40, BytesSent: 4}), filter, nil)
+	assert.Equal(t, traffic{Rx: 40, Tx: 4}, s.Usage["interface/eth1"].Today)
+
+	// Usage is kept across restarts.
+	assert.Nil(t, s.save())
+	s, err = loadUsageStore(path)
+	assert.Nil(t, err)
+
+	// After a reboot the counters start from zero. A new day and billing
+	// cycle reset the daily and cycle usage, but not the total.
+	s.update(day2, "boot2", 15, counters(20, 5), filter, nil)
+	u := s.Usage["interface/eth0"]
+	assert.Equal(t, traffic{Rx: 70, Tx: 25}, u.Total)
+	assert.Equal(t, traffic{Rx: 20, Tx: 5}, u.Today)
+	assert.Equal(t, traffic{Rx: 20, Tx: 5}, u.Cycle)
+	assert.Equal(t, "2024-03-15", u.CycleStart)
+	// The connection is no longer active, so it is only rolled over.
+	assert.Equal(t, traffic{}, s.Usage["connection/Office"].Today)
+	assert.Equal(t, traffic{Rx: 50, Tx: 20}, s.Usage["connection/Office"].Total)
+
+	// A counter that goes backwards was reset.
+	s.update(day2.Add(time.Minute), "boot2", 15, counters(8, 2), filter, nil)
+	assert.Equal(t, traffic{Rx: 28, Tx: 7}, s.Usage["interface/eth0"].Today)
+
+	// Excluded interfaces are never counted.
+	assert.NotContains(t, s.Usage, "interface/lo")
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+// Package notifications shows desktop notifications through the
+// org.freedesktop.Notifications D-Bus service.
+package notifications
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+	"github.com/joshuar/go-hass-agent/pkg/linux/dbusx"
+)
+
+const (
+	notificationsDest      = "org.freedesktop.Notifications"
+	notificationsPath      = "/org/freedesktop/Notifications"
+	notificationsInterface = notificationsDest
+	notifyMethod           = notificationsInterface + ".Notify"
+	closeMethod            = notificationsInterface + ".CloseNotification"
+	actionInvokedSignal    = notificationsInterface + ".ActionInvoked"
+	closedSignal           = notificationsInterface + ".NotificationClosed"
+
+	actionConfirm = "confirm"
+	actionCancel  = "cancel"
+)
+
+var ErrNoNotification = errors.New("could not show notification")
+
+// Confirm shows a notification with the given summary and body asking the user
+// to confirm an action. It returns true if the user confirms the action before
+// the timeout. If the user cancels or dismisses the notification, or the
+// timeout expires, it returns false.
+func Confirm(ctx context.Context, summary, body string, timeout time.Duration) (bool, error) {
+	ctx, cancelFunc := context.WithTimeout(ctx, timeout)
+	defer cancelFunc()
+
+	// Watch for the response before showing the notification so that it
+	// cannot be missed.
+	signals := make(chan *dbus.Signal, 10)
+	err := dbusx.NewBusRequest(ctx, dbusx.SessionBus).
+		Match([]dbus.MatchOption{
+			dbus.WithMatchObjectPath(notificationsPath),
+			dbus.WithMatchInterface(notificationsInterface),
+		}).
+		Handler(func(s *dbus.Signal) {
+			select {
+			case signals <- s:
+			default:
+			}
+		}).
+		AddWatch(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	hints := map[string]dbus.Variant{
+		"urgency":  dbus.MakeVariant(byte(2)),
+		"resident": dbus.MakeVariant(true),
+	}
+	id, ok := dbusx.NewBusRequest(ctx, dbusx.SessionBus).
+		Path(notificationsPath).
+		Destination(notificationsDest).
+		GetData(notifyMethod,
+			preferences.AppName, uint32(0), "dialog-warning", summary, body,
+			[]string{actionConfirm, "Allow", actionCancel, "Deny"},
+			hints, int32(timeout.Milliseconds())).
+		AsRawInterface().(uint32)
+	if !ok {
+		return false, ErrNoNotification
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Use a new context, as the notification should be closed even
+			// though the given one is done.
+			closeCtx, closeCancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+			_ = dbusx.NewBusRequest(closeCtx, dbusx.SessionBus).
+				Path(notificationsPath).
+				Destination(notificationsDest).
+				Call(closeMethod, id)
+			closeCancel()
+			return false, nil
+		case s := <-signals:
+			if len(s.Body) < 2 {
+				continue
+			}
+			if signalID, ok := s.Body[0].(uint32); !ok || signalID != id {
+				continue
+			}
+			switch s.Name {
+			case actionInvokedSignal:
+				action, _ := s.Body[1].(string)
+				return action == actionConfirm, nil
+			case closedSignal:
+				return false, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package power
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/joshuar/go-hass-agent/internal/device/helpers"
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+	"github.com/joshuar/go-hass-agent/pkg/linux/dbusx"
+)
+
+const (
+	loginDBusDest          = "org.freedesktop.login1"
+	loginDBusPath          = "/org/freedesktop/login1"
+	loginInhibitMethod     = loginDBusDest + ".Manager.Inhibit"
+	loginListInhibitMethod = loginDBusDest + ".Manager.ListInhibitors"
+
+	inhibitorsPollInterval = time.Minute
+)
+
+// Inhibitor is a lock, held by a program, that delays or blocks an action such
+// as sleep or shutdown.
+type Inhibitor struct {
+	What string `json:"what"`
+	Who  string `json:"who"`
+	Why  string `json:"why"`
+	Mode string `json:"mode"`
+	UID  uint32 `json:"uid"`
+	PID  uint32 `json:"pid"`
+}
+
+// Inhibit takes an inhibitor lock from systemd-logind for the given actions
+// (e.g., "sleep:idle") in the given mode ("block" or "delay"). The lock is held
+// until the returned file is closed.
+func Inhibit(ctx context.Context, what, who, why, mode string) (*os.File, error) {
+	fd, ok := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Path(loginDBusPath).
+		Destination(loginDBusDest).
+		GetData(loginInhibitMethod, what, who, why, mode).
+		AsRawInterface().(dbus.UnixFD)
+	if !ok {
+		return nil, errors.New("could not take inhibitor lock")
+	}
+	return os.NewFile(uintptr(fd), "inhibitor"), nil
+}
+
+// ListInhibitors returns the inhibitor locks currently held.
+func ListInhibitors(ctx context.Context) ([]Inhibitor, error) {
+	data, ok := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Path(loginDBusPath).
+		Destination(loginDBusDest).
+		GetData(loginListInhibitMethod).
+		AsRawInterface().([][]any)
+	if !ok {
+		return nil, errors.New("could not list inhibitors")
+	}
+	inhibitors := make([]Inhibitor, 0, len(data))
+	for _, fields := range data {
+		if len(fields) < 6 {
+			continue
+		}
+		var i Inhibitor
+		i.What, _ = fields[0].(string)
+		i.Who, _ = fields[1].(string)
+		i.Why, _ = fields[2].(string)
+		i.Mode, _ = fields[3].(string)
+		i.UID, _ = fields[4].(uint32)
+		i.PID, _ = fields[5].(uint32)
+		inhibitors = append(inhibitors, i)
+	}
+	return inhibitors, nil
+}
+
+type inhibitorsSensor struct {
+	inhibitors []Inhibitor
+	linux.Sensor
+}
+
+type inhibitorsSensorAttributes struct {
+	DataSource string      `json:"Data Source"`
+	Inhibitors []Inhibitor `json:"Inhibitors"`
+}
+
+func (s *inhibitorsSensor) Attributes() any {
+	return &inhibitorsSensorAttributes{
+		DataSource: linux.DataSrcDbus,
+		Inhibitors: s.inhibitors,
+	}
+}
+
+// Icon shows whether anything is currently blocking sleep.
+func (s *inhibitorsSensor) Icon() string {
+	for _, i := range s.inhibitors {
+		if i.Mode == "block" && strings.Contains(i.What, "sleep") {
+			return "mdi:sleep-off"
+		}
+	}
+	return "mdi:sleep"
+}
+
+func newInhibitorsSensor(inhibitors []Inhibitor) *inhibitorsSensor {
+	s := &inhibitorsSensor{inhibitors: inhibitors}
+	s.Value = len(inhibitors)
+	s.SensorTypeValue = linux.SensorInhibitors
+	s.SensorSrc = linux.DataSrcDbus
+	s.StateClassValue = sensor.StateMeasurement
+	return s
+}
+
+// InhibitorsUpdater reports the count of inhibitor locks currently held, with
+// the details of each lock as attributes.
+func InhibitorsUpdater(ctx context.Context) chan tracker.Sensor {
+	sensorCh := make(chan tracker.Sensor)
+	update := func(_ time.Duration) {
+		inhibitors, err := ListInhibitors(ctx)
+		if err != nil {
+			log.Debug().Err(err).Msg("Could not retrieve inhibitors.")
+			return
+		}
+		sensorCh <- newInhibitorsSensor(inhibitors)
+	}
+	go helpers.PollSensors(ctx, update, inhibitorsPollInterval, time.Second)
+	go func() {
+		defer close(sensorCh)
+		<-ctx.Done()
+		log.Debug().Msg("Stopped inhibitors sensor.")
+	}()
+	return sensorCh
+}
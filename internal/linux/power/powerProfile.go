@@ -51,9 +51,9 @@ func PowerProfileUpdater(ctx context.Context) chan tracker.Sensor {
 
 	err = dbusx.NewBusRequest(ctx, dbusx.SystemBus).
 		Match([]dbus.MatchOption{
-			dbus.WithMatchInterface(powerProfilesDBusDest),
 			dbus.WithMatchObjectPath(powerProfilesDBusPath),
-			dbus.WithMatchMember("ActiveProfile"),
+			dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+			dbus.WithMatchMember("PropertiesChanged"),
 		}).
 		Handler(func(s *dbus.Signal) {
 			if s.Name != dbusx.PropChangedSignal || s.Path != powerProfilesDBusPath {
@@ -92,3 +92,31 @@ func PowerProfileUpdater(ctx context.Context) chan tracker.Sensor {
 	}()
 	return sensorCh
 }
+
+// PowerProfiles returns the names of the power profiles available from
+// power-profiles-daemon.
+func PowerProfiles(ctx context.Context) ([]string, error) {
+	v, err := dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Path(powerProfilesDBusPath).
+		Destination(powerProfilesDBusDest).
+		GetProp(powerProfilesDBusDest + ".Profiles")
+	if err != nil {
+		return nil, err
+	}
+	var profiles []string
+	for _, p := range dbusx.VariantToValue[[]map[string]dbus.Variant](v) {
+		if name, ok := p["Profile"]; ok {
+			profiles = append(profiles, dbusx.VariantToValue[string](name))
+		}
+	}
+	return profiles, nil
+}
+
+// SetPowerProfile sets the active power profile of power-profiles-daemon to
+// the given profile.
+func SetPowerProfile(ctx context.Context, profile string) error {
+	return dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Path(powerProfilesDBusPath).
+		Destination(powerProfilesDBusDest).
+		SetProp(powerProfilesDBusDest+".ActiveProfile", dbus.MakeVariant(profile))
+}
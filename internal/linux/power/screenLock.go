@@ -90,3 +90,35 @@ func ScreenLockUpdater(ctx context.Context) chan tracker.Sensor {
 	}()
 	return sensorCh
 }
+
+// WatchUnlock calls unlocked whenever a login session is unlocked, as shown by
+// its LockedHint changing from true to false. Unlike the screen lock sensor,
+// changes in whether the session is idle are ignored.
+func WatchUnlock(ctx context.Context, unlocked func()) error {
+	locked := make(map[dbus.ObjectPath]bool)
+	return dbusx.NewBusRequest(ctx, dbusx.SystemBus).
+		Match([]dbus.MatchOption{
+			dbus.WithMatchPathNamespace("/org/freedesktop/login1/session"),
+			dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+			dbus.WithMatchMember("PropertiesChanged"),
+		}).
+		Handler(func(s *dbus.Signal) {
+			if !strings.Contains(string(s.Path), "/org/freedesktop/login1/session") || s.Name != dbusx.PropChangedSignal || len(s.Body) <= 1 {
+				return
+			}
+			props, ok := s.Body[1].(map[string]dbus.Variant)
+			if !ok {
+				return
+			}
+			v, ok := props["LockedHint"]
+			if !ok {
+				return
+			}
+			now := dbusx.VariantToValue[bool](v)
+			if locked[s.Path] && !now {
+				unlocked()
+			}
+			locked[s.Path] = now
+		}).
+		AddWatch(ctx)
+}
@@ -0,0 +1,295 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package pressure
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iancoleman/strcase"
+	"github.com/rs/zerolog/log"
+
+	"github.com/joshuar/go-hass-agent/internal/device/helpers"
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+const pollInterval = 10 * time.Second
+
+// resources are the resources that PSI is reported for, keyed by the name
+// used in the PSI files.
+var resources = []struct {
+	file  string
+	label string
+}{
+	{file: "cpu", label: "CPU"},
+	{file: "memory", label: "Memory"},
+	{file: "io", label: "IO"},
+}
+
+// stall is the share of time in which tasks were stalled waiting for a
+// resource, as reported by a line of a PSI file.
+type stall struct {
+	// Avg10, Avg60 and Avg300 are the percentages of time stalled over the
+	// last 10, 60 and 300 seconds.
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	// Total is the total time stalled, in microseconds.
+	Total uint64
+}
+
+// psi is the pressure on a resource. Some is the time in which at least one
+// task was stalled, and Full the time in which all non-idle tasks were stalled
+// at once.
+type psi struct {
+	Some stall
+	Full *stall
+}
+
+// parsePSI parses the contents of a PSI file. The full line is missing for
+// the CPU on older kernels.
+func parsePSI(r io.Reader) (*psi, error) {
+	p := &psi{}
+	var hasSome bool
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		s, err := parseStall(fields[1:])
+		if err != nil {
+			return nil, err
+		}
+		switch fields[0] {
+		case "some":
+			p.Some = *s
+			hasSome = true
+		case "full":
+			p.Full = s
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !hasSome {
+		return nil, errors.New("no pressure data")
+	}
+	return p, nil
+}
+
+func parseStall(fields []string) (*stall, error) {
+	s := &stall{}
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+		var err error
+		switch key {
+		case "avg10":
+			s.Avg10, err = strconv.ParseFloat(value, 64)
+		case "avg60":
+			s.Avg60, err = strconv.ParseFloat(value, 64)
+		case "avg300":
+			s.Avg300, err = strconv.ParseFloat(value, 64)
+		case "total":
+			s.Total, err = strconv.ParseUint(value, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid field %q: %w", field, err)
+		}
+	}
+	return s, nil
+}
+
+func readPSI(path string) (*psi, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parsePSI(f)
+}
+
+// source is a set of PSI files to report: either the system-wide files or
+// those of a cgroup.
+type source struct {
+	// prefix is prepended to the names of the sensors.
+	prefix string
+	// dir is the directory holding the PSI files.
+	dir string
+	// pattern is the name of the PSI files, with %s replaced by the name of
+	// the resource.
+	pattern string
+	// cgroup is whether the files are those of a cgroup. At the system level,
+	// full CPU pressure is always zero, so it is only reported for cgroups.
+	cgroup bool
+	src    string
+}
+
+func (s *source) path(resource string) string {
+	return filepath.Join(s.dir, fmt.Sprintf(s.pattern, resource))
+}
+
+// available returns whether the PSI files of the source can be read. They
+// are missing on kernels without PSI and cannot be read if it is disabled.
+func (s *source) available() bool {
+	_, err := readPSI(s.path(resources[0].file))
+	return err == nil
+}
+
+// systemSource returns the source of system-wide PSI.
+func systemSource() *source {
+	return &source{
+		dir:     filepath.Join(linux.ProcfsRoot(), "pressure"),
+		pattern: "%s",
+		src:     linux.DataSrcProcfs,
+	}
+}
+
+// sessionSource returns the source of PSI for the user's session slice.
+// It is only available with the unified (v2) cgroup hierarchy.
+func sessionSource() *source {
+	return &source{
+		prefix:  "Session",
+		dir:     filepath.Join(linux.SysfsRoot(), "fs", "cgroup", "user.slice", fmt.Sprintf("user-%d.slice", os.Getuid())),
+		pattern: "%s.pressure",
+		cgroup:  true,
+		src:     linux.DataSrcSysfs,
+	}
+}
+
+type pressureSensor struct {
+	prefix   string
+	resource string
+	stall    stall
+	linux.Sensor
+}
+
+type pressureSensorAttributes struct {
+	DataSource string  `json:"Data Source"`
+	Avg10      float64 `json:"Last 10 Seconds"`
+	Avg60      float64 `json:"Last 60 Seconds"`
+	Avg300     float64 `json:"Last 300 Seconds"`
+}
+
+func (s *pressureSensor) Name() string {
+	return strings.TrimSpace(s.prefix + " " + s.resource + " " + s.SensorTypeValue.String())
+}
+
+func (s *pressureSensor) ID() string {
+	return strcase.ToSnake(s.prefix + " " + s.resource + " " + s.SensorTypeValue.String())
+}
+
+func (s *pressureSensor) Attributes() any {
+	if s.SensorTypeValue == linux.SensorStallTimeSome || s.SensorTypeValue == linux.SensorStallTimeFull {
+		return s.Sensor.Attributes()
+	}
+	return &pressureSensorAttributes{
+		DataSource: s.SensorSrc,
+		Avg10:      s.stall.Avg10,
+		Avg60:      s.stall.Avg60,
+		Avg300:     s.stall.Avg300,
+	}
+}
+
+func newPressureSensor(src *source, resource string, t linux.SensorTypeValue, st stall) *pressureSensor {
+	s := &pressureSensor{prefix: src.prefix, resource: resource, stall: st}
+	s.Value = st.Avg10
+	s.SensorTypeValue = t
+	s.SensorSrc = src.src
+	s.IconString = "mdi:gauge"
+	s.UnitsString = "%"
+	s.StateClassValue = sensor.StateMeasurement
+	return s
+}
+
+// newStallTimeSensor creates a sensor for the total time, in seconds, in which
+// tasks were stalled waiting for the resource.
+func newStallTimeSensor(src *source, resource string, t linux.SensorTypeValue, st stall) *pressureSensor {
+	s := &pressureSensor{prefix: src.prefix, resource: resource, stall: st}
+	s.Value = math.Round(float64(st.Total)/1e3) / 1e3
+	s.SensorTypeValue = t
+	s.SensorSrc = src.src
+	s.IconString = "mdi:timer-sand"
+	s.UnitsString = "s"
+	s.DeviceClassValue = sensor.Duration
+	s.StateClassValue = sensor.StateTotalIncreasing
+	return s
+}
+
+// newPressureSensors creates the some and (where meaningful) full pressure and
+// stall time sensors for each resource of the source. Resources that cannot be
+// read are skipped.
+func newPressureSensors(src *source) []tracker.Sensor {
+	var sensors []tracker.Sensor
+	for _, r := range resources {
+		p, err := readPSI(src.path(r.file))
+		if err != nil {
+			log.Debug().Err(err).Str("resource", r.file).Msg("Could not read pressure.")
+			continue
+		}
+		sensors = append(sensors,
+			newPressureSensor(src, r.label, linux.SensorPressureSome, p.Some),
+			newStallTimeSensor(src, r.label, linux.SensorStallTimeSome, p.Some))
+		if p.Full != nil && (src.cgroup || r.file != "cpu") {
+			sensors = append(sensors,
+				newPressureSensor(src, r.label, linux.SensorPressureFull, *p.Full),
+				newStallTimeSensor(src, r.label, linux.SensorStallTimeFull, *p.Full))
+		}
+	}
+	return sensors
+}
+
+// Updater reports the pressure stall information (PSI) for the CPU, memory
+// and IO, system-wide and, with the unified cgroup hierarchy, for the user's
+// session slice. The sensors show the percentage of the last 10 seconds in
+// which tasks were stalled waiting for the resource and the total time they
+// have been stalled. No sensors are reported if the kernel does not support
+// PSI or it is disabled.
+func Updater(ctx context.Context) chan tracker.Sensor {
+	sensorCh := make(chan tracker.Sensor)
+
+	var sources []*source
+	for _, src := range []*source{systemSource(), sessionSource()} {
+		if src.available() {
+			sources = append(sources, src)
+		}
+	}
+	if len(sources) == 0 {
+		log.Debug().Msg("Pressure stall information is not available. Pressure sensors will not run.")
+		close(sensorCh)
+		return sensorCh
+	}
+
+	sendPressure := func(_ time.Duration) {
+		for _, src := range sources {
+			for _, s := range newPressureSensors(src) {
+				sensorCh <- s
+			}
+		}
+	}
+
+	go helpers.PollSensors(ctx, sendPressure, pollInterval, time.Second)
+	go func() {
+		defer close(sensorCh)
+		<-ctx.Done()
+		log.Debug().Msg("Stopped pressure sensors.")
+	}()
+	return sensorCh
+}
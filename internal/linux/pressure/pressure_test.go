@@ -0,0 +1,98 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package pressure
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/joshuar/go-hass-agent/internal/linux"
+)
+
+func Test_parsePSI(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    *psi
+		wantErr bool
+	}{
+		{
+			name: "some and full",
+			input: "some avg10=5.18 avg60=4.04 avg300=2.88 total=230246063\n" +
+				"full avg10=1.00 avg60=0.50 avg300=0.25 total=1000\n",
+			want: &psi{
+				Some: stall{Avg10: 5.18, Avg60: 4.04, Avg300: 2.88, Total: 230246063},
+				Full: &stall{Avg10: 1, Avg60: 0.5, Avg300: 0.25, Total: 1000},
+			},
+		},
+		{
+			name:  "some only",
+			input: "some avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+			want:  &psi{},
+		},
+		{
+			name:    "empty",
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			input:   "some avg10=x avg60=0.00 avg300=0.00 total=0\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePSI(strings.NewReader(tt.input))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_newPressureSensors(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv(linux.ProcfsEnv, root)
+	dir := filepath.Join(root, "pressure")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	psi := "some avg10=1.00 avg60=0.00 avg300=0.00 total=1234567\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n"
+	// IO pressure is missing.
+	for _, resource := range []string{"cpu", "memory"} {
+		if err := os.WriteFile(filepath.Join(dir, resource), []byte(psi), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src := systemSource()
+	assert.True(t, src.available())
+	var ids []string
+	states := make(map[string]any)
+	for _, s := range newPressureSensors(src) {
+		ids = append(ids, s.ID())
+		states[s.ID()] = s.State()
+	}
+	// Full CPU pressure is not reported system-wide.
+	assert.Equal(t, []string{
+		"cpu_pressure", "cpu_stall_time",
+		"memory_pressure", "memory_stall_time", "memory_full_pressure", "memory_full_stall_time",
+	}, ids)
+	assert.Equal(t, 1.0, states["cpu_pressure"])
+	// Stall time is reported in seconds.
+	assert.Equal(t, 1.235, states["cpu_stall_time"])
+
+	t.Setenv(linux.SysfsEnv, root)
+	assert.False(t, sessionSource().available())
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+// Package process reports the processes using the most CPU and memory, and the
+// usage of specific named processes, from procfs.
+package process
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// procStats is the resource usage of a process. CPU usage is a percentage of a
+// single CPU (as shown by top), so a process using several CPUs can be above
+// 100%.
+type procStats struct {
+	proc   *process.Process
+	Name   string
+	PID    int32
+	CPU    float64
+	Memory float64
+	RSS    uint64
+}
+
+// user returns the name of the user running the process, looked up only when
+// needed as it is not cheap.
+func (p *procStats) user(ctx context.Context) string {
+	if p.proc == nil {
+		return ""
+	}
+	user, err := p.proc.UsernameWithContext(ctx)
+	if err != nil {
+		return ""
+	}
+	return user
+}
+
+// cpuSample is the total CPU time used by a process up to a point in time.
+type cpuSample struct {
+	at    time.Time
+	total float64
+}
+
+// sampler tracks the CPU time used by each process between samples, so that
+// the CPU usage reported is recent rather than averaged over the lifetime of
+// the process.
+type sampler struct {
+	prev map[int32]cpuSample
+}
+
+func newSampler() *sampler {
+	return &sampler{prev: make(map[int32]cpuSample)}
+}
+
+// sample returns the current resource usage of every process that could be
+// read. Processes that exit while being read are skipped.
+func (s *sampler) sample(ctx context.Context) ([]*procStats, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vm, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	next := make(map[int32]cpuSample, len(procs))
+	stats := make([]*procStats, 0, len(procs))
+	for _, p := range procs {
+		name, err := p.NameWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		times, err := p.TimesWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		memInfo, err := p.MemoryInfoWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		total := times.User + times.System
+		current := cpuSample{at: now, total: total}
+		next[p.Pid] = current
+
+		// For processes not seen in the last sample, use the average since
+		// the process started.
+		prev, ok := s.prev[p.Pid]
+		if !ok {
+			created, err := p.CreateTimeWithContext(ctx)
+			if err != nil {
+				continue
+			}
+			prev = cpuSample{at: time.UnixMilli(created)}
+		}
+
+		stats = append(stats, &procStats{
+			proc:   p,
+			Name:   name,
+			PID:    p.Pid,
+			CPU:    cpuPercent(prev, current),
+			RSS:    memInfo.RSS,
+			Memory: float64(memInfo.RSS) / float64(vm.Total) * 100,
+		})
+	}
+	s.prev = next
+	return stats, nil
+}
+
+// cpuPercent returns the percentage of a single CPU used between the two
+// samples.
+func cpuPercent(prev, current cpuSample) float64 {
+	elapsed := current.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 || current.total < prev.total {
+		return 0
+	}
+	return (current.total - prev.total) / elapsed * 100
+}
+
+// topBy returns up to n processes with the highest value of the given usage,
+// highest first.
+func topBy(stats []*procStats, n int, usage func(*procStats) float64) []*procStats {
+	sorted := slices.Clone(stats)
+	slices.SortStableFunc(sorted, func(a, b *procStats) int {
+		switch {
+		case usage(a) > usage(b):
+			return -1
+		case usage(a) < usage(b):
+			return 1
+		default:
+			return 0
+		}
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// trackedStats is the combined resource usage of all processes with a name.
+type trackedStats struct {
+	Name string
+	PIDs []int32
+	CPU  float64
+	RSS  uint64
+}
+
+// track returns the combined resource usage of the processes with the given
+// name.
+func track(stats []*procStats, name string) *trackedStats {
+	t := &trackedStats{Name: name, PIDs: []int32{}}
+	for _, p := range stats {
+		if p.Name != name {
+			continue
+		}
+		t.PIDs = append(t.PIDs, p.PID)
+		t.CPU += p.CPU
+		t.RSS += p.RSS
+	}
+	return t
+}
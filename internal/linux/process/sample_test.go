@@ -0,0 +1,88 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_cpuPercent(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name    string
+		prev    cpuSample
+		current cpuSample
+		want    float64
+	}{
+		{
+			name:    "one cpu",
+			prev:    cpuSample{at: start, total: 10},
+			current: cpuSample{at: start.Add(10 * time.Second), total: 20},
+			want:    100,
+		},
+		{
+			name:    "several cpus",
+			prev:    cpuSample{at: start, total: 10},
+			current: cpuSample{at: start.Add(10 * time.Second), total: 35},
+			want:    250,
+		},
+		{
+			name:    "no time elapsed",
+			prev:    cpuSample{at: start, total: 10},
+			current: cpuSample{at: start, total: 20},
+			want:    0,
+		},
+		{
+			name:    "pid reused",
+			prev:    cpuSample{at: start, total: 20},
+			current: cpuSample{at: start.Add(10 * time.Second), total: 1},
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, cpuPercent(tt.prev, tt.current), 0.001)
+		})
+	}
+}
+
+func Test_topBy(t *testing.T) {
+	stats := []*procStats{
+		{Name: "idle", PID: 1, CPU: 0, Memory: 1},
+		{Name: "browser", PID: 2, CPU: 40, Memory: 30},
+		{Name: "compiler", PID: 3, CPU: 180, Memory: 5},
+		{Name: "browser", PID: 4, CPU: 10, Memory: 12},
+	}
+	pids := func(procs []*procStats) []int32 {
+		var pids []int32
+		for _, p := range procs {
+			pids = append(pids, p.PID)
+		}
+		return pids
+	}
+
+	byCPU := topBy(stats, 2, func(p *procStats) float64 { return p.CPU })
+	assert.Equal(t, []int32{3, 2}, pids(byCPU))
+	byMemory := topBy(stats, 3, func(p *procStats) float64 { return p.Memory })
+	assert.Equal(t, []int32{2, 4, 3}, pids(byMemory))
+	all := topBy(stats, 10, func(p *procStats) float64 { return p.CPU })
+	assert.Len(t, all, len(stats))
+	// The original order should be kept.
+	assert.Equal(t, []int32{1, 2, 3, 4}, pids(stats))
+}
+
+func Test_track(t *testing.T) {
+	stats := []*procStats{
+		{Name: "browser", PID: 2, CPU: 40, RSS: 300},
+		{Name: "compiler", PID: 3, CPU: 180, RSS: 50},
+		{Name: "browser", PID: 4, CPU: 10, RSS: 120},
+	}
+	assert.Equal(t, &trackedStats{Name: "browser", PIDs: []int32{2, 4}, CPU: 50, RSS: 420}, track(stats, "browser"))
+	assert.Equal(t, &trackedStats{Name: "steam", PIDs: []int32{}}, track(stats, "steam"))
+}
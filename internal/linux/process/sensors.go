@@ -0,0 +1,195 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package process
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/iancoleman/strcase"
+	"github.com/rs/zerolog/log"
+
+	"github.com/joshuar/go-hass-agent/internal/device/helpers"
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+const processPollInterval = 30 * time.Second
+
+// topProcess is a process listed in the attributes of a top process sensor.
+type topProcess struct {
+	Name   string  `json:"name"`
+	User   string  `json:"user"`
+	PID    int32   `json:"pid"`
+	CPU    float64 `json:"cpu_percent"`
+	Memory float64 `json:"memory_percent"`
+}
+
+type topProcessSensor struct {
+	procs []topProcess
+	linux.Sensor
+}
+
+type topProcessSensorAttributes struct {
+	DataSource string       `json:"Data Source"`
+	Name       string       `json:"Name,omitempty"`
+	User       string       `json:"User,omitempty"`
+	Processes  []topProcess `json:"Processes"`
+	PID        int32        `json:"PID,omitempty"`
+}
+
+func (s *topProcessSensor) Attributes() any {
+	attrs := &topProcessSensorAttributes{
+		DataSource: linux.DataSrcProcfs,
+		Processes:  s.procs,
+	}
+	if len(s.procs) > 0 {
+		attrs.Name = s.procs[0].Name
+		attrs.User = s.procs[0].User
+		attrs.PID = s.procs[0].PID
+	}
+	return attrs
+}
+
+// newTopProcessSensor creates a sensor of the given type whose value is the
+// usage of the top process, listing the top processes as attributes.
+func newTopProcessSensor(ctx context.Context, sensorType linux.SensorTypeValue, top []*procStats) *topProcessSensor {
+	s := &topProcessSensor{procs: make([]topProcess, 0, len(top))}
+	for _, p := range top {
+		s.procs = append(s.procs, topProcess{
+			Name:   p.Name,
+			User:   p.user(ctx),
+			PID:    p.PID,
+			CPU:    round(p.CPU),
+			Memory: round(p.Memory),
+		})
+	}
+	s.Value = 0.0
+	if len(s.procs) > 0 {
+		s.Value = s.procs[0].CPU
+		if sensorType == linux.SensorTopMemProcess {
+			s.Value = s.procs[0].Memory
+		}
+	}
+	s.IconString = "mdi:chip"
+	if sensorType == linux.SensorTopMemProcess {
+		s.IconString = "mdi:memory"
+	}
+	s.UnitsString = "%"
+	s.SensorTypeValue = sensorType
+	s.SensorSrc = linux.DataSrcProcfs
+	s.StateClassValue = sensor.StateMeasurement
+	return s
+}
+
+type trackedProcessSensor struct {
+	stats *trackedStats
+	linux.Sensor
+}
+
+type trackedProcessSensorAttributes struct {
+	DataSource string  `json:"Data Source"`
+	PIDs       []int32 `json:"PIDs"`
+}
+
+func (s *trackedProcessSensor) Name() string {
+	return s.stats.Name + " " + s.SensorTypeValue.String()
+}
+
+func (s *trackedProcessSensor) ID() string {
+	return strcase.ToSnake(s.stats.Name + "_" + s.SensorTypeValue.String())
+}
+
+func (s *trackedProcessSensor) Attributes() any {
+	return &trackedProcessSensorAttributes{
+		DataSource: linux.DataSrcProcfs,
+		PIDs:       s.stats.PIDs,
+	}
+}
+
+// newTrackedProcessSensors creates sensors for whether the processes with a
+// name are running and their combined CPU and memory usage.
+func newTrackedProcessSensors(stats *trackedStats) []tracker.Sensor {
+	running := &trackedProcessSensor{stats: stats}
+	running.Value = len(stats.PIDs) > 0
+	running.IsBinary = true
+	running.IconString = "mdi:application-cog"
+	running.SensorTypeValue = linux.SensorProcessRunning
+	running.SensorSrc = linux.DataSrcProcfs
+
+	cpu := &trackedProcessSensor{stats: stats}
+	cpu.Value = round(stats.CPU)
+	cpu.IconString = "mdi:chip"
+	cpu.UnitsString = "%"
+	cpu.SensorTypeValue = linux.SensorProcessCPU
+	cpu.SensorSrc = linux.DataSrcProcfs
+	cpu.StateClassValue = sensor.StateMeasurement
+
+	memory := &trackedProcessSensor{stats: stats}
+	memory.Value = stats.RSS
+	memory.IconString = "mdi:memory"
+	memory.UnitsString = "B"
+	memory.SensorTypeValue = linux.SensorProcessMem
+	memory.SensorSrc = linux.DataSrcProcfs
+	memory.DeviceClassValue = sensor.Data_size
+	memory.StateClassValue = sensor.StateMeasurement
+
+	return []tracker.Sensor{running, cpu, memory}
+}
+
+// round rounds a percentage to two decimal places.
+func round(pc float64) float64 {
+	return math.Round(pc*100) / 100
+}
+
+// Updater reports the processes using the most CPU and memory and the usage
+// of the processes named in the preferences. The number of top processes
+// listed and the processes tracked are set in the preferences.
+func Updater(ctx context.Context) chan tracker.Sensor {
+	sensorCh := make(chan tracker.Sensor)
+	prefs := preferences.FetchFromContext(ctx)
+	n := prefs.Processes.Top
+	tracked := prefs.Processes.Tracked
+	if n == 0 && len(tracked) == 0 {
+		close(sensorCh)
+		return sensorCh
+	}
+
+	s := newSampler()
+	update := func(_ time.Duration) {
+		stats, err := s.sample(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not retrieve process usage.")
+			return
+		}
+		var sensors []tracker.Sensor
+		if n > 0 {
+			sensors = append(sensors,
+				newTopProcessSensor(ctx, linux.SensorTopCPUProcess,
+					topBy(stats, n, func(p *procStats) float64 { return p.CPU })),
+				newTopProcessSensor(ctx, linux.SensorTopMemProcess,
+					topBy(stats, n, func(p *procStats) float64 { return p.Memory })),
+			)
+		}
+		for _, name := range tracked {
+			sensors = append(sensors, newTrackedProcessSensors(track(stats, name))...)
+		}
+		for _, s := range sensors {
+			sensorCh <- s
+		}
+	}
+
+	go helpers.PollSensors(ctx, update, processPollInterval, time.Second*5)
+	go func() {
+		defer close(sensorCh)
+		<-ctx.Done()
+		log.Debug().Msg("Stopped process sensors.")
+	}()
+	return sensorCh
+}
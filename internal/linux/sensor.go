@@ -44,6 +44,12 @@ func (l *Sensor) ID() string {
 	return strcase.ToSnake(l.SensorTypeValue.String())
 }
 
+// Type returns the type of Linux sensor, which can be used to identify the
+// sensor regardless of any custom name or ID.
+func (l *Sensor) Type() SensorTypeValue {
+	return l.SensorTypeValue
+}
+
 func (l *Sensor) State() any {
 	return l.Value
 }
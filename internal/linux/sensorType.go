@@ -59,6 +59,36 @@ const (
 	SensorUsers                                        // Current Users
 	SensorDeviceTemp                                   // Temperature
 	SensorPowerState                                   // Power State
+	SensorMediaState                                   // Media State
+	SensorMediaTitle                                   // Media Title
+	SensorMediaArtist                                  // Media Artist
+	SensorMediaAlbum                                   // Media Album
+	SensorMediaPosition                                // Media Position
+	SensorInhibitors                                   // Inhibitors
+	SensorUnitState                                    // Unit State
+	SensorFailedUnits                                  // Failed Units
+	SensorFailedUserUnits                              // Failed User Units
+	SensorTopCPUProcess                                // Top CPU Process
+	SensorTopMemProcess                                // Top Memory Process
+	SensorProcessRunning                               // Process Running
+	SensorProcessCPU                                   // Process CPU Usage
+	SensorProcessMem                                   // Process Memory Usage
+	SensorLinkSpeed                                    // Link Speed
+	SensorLinkState                                    // Link State
+	SensorDataUsage                                    // Data Usage
+	SensorDataUsageToday                               // Data Usage Today
+	SensorDataUsageMonth                               // Data Usage This Month
+	SensorMetered                                      // Metered Connection
+	SensorDiskReadRate                                 // Read Rate
+	SensorDiskWriteRate                                // Write Rate
+	SensorDiskIOPS                                     // IOPS
+	SensorDiskUtilization                              // Utilization
+	SensorDiskUsage                                    // Usage
+	SensorDiskInodes                                   // Inode Usage
+	SensorPressureSome                                 // Pressure
+	SensorPressureFull                                 // Full Pressure
+	SensorStallTimeSome                                // Stall Time
+	SensorStallTimeFull                                // Full Stall Time
 )
 
 // SensorTypeValue represents the unique type of sensor data being reported. Every
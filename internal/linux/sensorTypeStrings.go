@@ -60,11 +60,41 @@ func _() {
 	_ = x[SensorUsers-50]
 	_ = x[SensorDeviceTemp-51]
 	_ = x[SensorPowerState-52]
+	_ = x[SensorMediaState-53]
+	_ = x[SensorMediaTitle-54]
+	_ = x[SensorMediaArtist-55]
+	_ = x[SensorMediaAlbum-56]
+	_ = x[SensorMediaPosition-57]
+	_ = x[SensorInhibitors-58]
+	_ = x[SensorUnitState-59]
+	_ = x[SensorFailedUnits-60]
+	_ = x[SensorFailedUserUnits-61]
+	_ = x[SensorTopCPUProcess-62]
+	_ = x[SensorTopMemProcess-63]
+	_ = x[SensorProcessRunning-64]
+	_ = x[SensorProcessCPU-65]
+	_ = x[SensorProcessMem-66]
+	_ = x[SensorLinkSpeed-67]
+	_ = x[SensorLinkState-68]
+	_ = x[SensorDataUsage-69]
+	_ = x[SensorDataUsageToday-70]
+	_ = x[SensorDataUsageMonth-71]
+	_ = x[SensorMetered-72]
+	_ = x[SensorDiskReadRate-73]
+	_ = x[SensorDiskWriteRate-74]
+	_ = x[SensorDiskIOPS-75]
+	_ = x[SensorDiskUtilization-76]
+	_ = x[SensorDiskUsage-77]
+	_ = x[SensorDiskInodes-78]
+	_ = x[SensorPressureSome-79]
+	_ = x[SensorPressureFull-80]
+	_ = x[SensorStallTimeSome-81]
+	_ = x[SensorStallTimeFull-82]
 }
 
-const _SensorTypeValue_name = "Active AppRunning AppsBattery TypeBattery LevelBattery TemperatureBattery VoltageBattery EnergyBattery PowerBattery StateBattery PathBattery LevelBattery ModelMemory TotalMemory AvailableMemory UsedMemory UsageSwap Memory TotalSwap Memory UsedSwap Memory FreeSwap UsageConnection StateConnection IDConnection DeviceConnection TypeConnection IPv4Connection IPv6IPv4 AddressIPv6 AddressWi-Fi SSIDWi-Fi FrequencyWi-Fi Link SpeedWi-Fi Signal StrengthWi-Fi BSSIDBytes SentBytes ReceivedBytes Sent ThroughputBytes Received ThroughputPower ProfileLast RebootUptimeCPU load average (1 min)CPU load average (5 min)CPU load average (15 min)CPU UsageScreen LockProblemsKernel VersionDistribution NameDistribution VersionCurrent UsersTemperaturePower State"
+const _SensorTypeValue_name = "Active AppRunning AppsBattery TypeBattery LevelBattery TemperatureBattery VoltageBattery EnergyBattery PowerBattery StateBattery PathBattery LevelBattery ModelMemory TotalMemory AvailableMemory UsedMemory UsageSwap Memory TotalSwap Memory UsedSwap Memory FreeSwap UsageConnection StateConnection IDConnection DeviceConnection TypeConnection IPv4Connection IPv6IPv4 AddressIPv6 AddressWi-Fi SSIDWi-Fi FrequencyWi-Fi Link SpeedWi-Fi Signal StrengthWi-Fi BSSIDBytes SentBytes ReceivedBytes Sent ThroughputBytes Received ThroughputPower ProfileLast RebootUptimeCPU load average (1 min)CPU load average (5 min)CPU load average (15 min)CPU UsageScreen LockProblemsKernel VersionDistribution NameDistribution VersionCurrent UsersTemperaturePower StateMedia StateMedia TitleMedia ArtistMedia AlbumMedia PositionInhibitorsUnit StateFailed UnitsFailed User UnitsTop CPU ProcessTop Memory ProcessProcess RunningProcess CPU UsageProcess Memory UsageLink SpeedLink StateData UsageData Usage TodayData Usage This MonthMetered ConnectionRead RateWrite RateIOPSUtilizationUsageInode UsagePressureFull PressureStall TimeFull Stall Time"
 
-var _SensorTypeValue_index = [...]uint16{0, 10, 22, 34, 47, 66, 81, 95, 108, 121, 133, 146, 159, 171, 187, 198, 210, 227, 243, 259, 269, 285, 298, 315, 330, 345, 360, 372, 384, 394, 409, 425, 446, 457, 467, 481, 502, 527, 540, 551, 557, 581, 605, 630, 639, 650, 658, 672, 689, 709, 722, 733, 744}
+var _SensorTypeValue_index = [...]uint16{0, 10, 22, 34, 47, 66, 81, 95, 108, 121, 133, 146, 159, 171, 187, 198, 210, 227, 243, 259, 269, 285, 298, 315, 330, 345, 360, 372, 384, 394, 409, 425, 446, 457, 467, 481, 502, 527, 540, 551, 557, 581, 605, 630, 639, 650, 658, 672, 689, 709, 722, 733, 744, 755, 766, 778, 789, 803, 813, 823, 835, 852, 867, 885, 900, 917, 937, 947, 957, 967, 983, 1004, 1022, 1031, 1041, 1045, 1056, 1061, 1072, 1080, 1093, 1103, 1118}
 
 func (i SensorTypeValue) String() string {
 	i -= 1
@@ -0,0 +1,182 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package systemd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/joshuar/go-hass-agent/internal/device/helpers"
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	"github.com/joshuar/go-hass-agent/internal/linux"
+	"github.com/joshuar/go-hass-agent/internal/preferences"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+const failedUnitsPollInterval = time.Minute
+
+type unitSensor struct {
+	unit *Unit
+	linux.Sensor
+}
+
+type unitSensorAttributes struct {
+	DataSource  string `json:"Data Source"`
+	Description string `json:"Description"`
+	LoadState   string `json:"Load State"`
+	SubState    string `json:"Sub State"`
+	Bus         string `json:"Bus"`
+}
+
+func (s *unitSensor) Name() string {
+	return s.unit.Name + " State"
+}
+
+func (s *unitSensor) ID() string {
+	if s.unit.User {
+		return "systemd_user_unit_" + UnitID(s.unit.Name)
+	}
+	return "systemd_unit_" + UnitID(s.unit.Name)
+}
+
+func (s *unitSensor) Icon() string {
+	switch {
+	case s.unit.Running():
+		return "mdi:cog-play"
+	case s.unit.ActiveState == activeStateFailed:
+		return "mdi:cog-off"
+	default:
+		return "mdi:cog-stop"
+	}
+}
+
+func (s *unitSensor) Attributes() any {
+	attrs := &unitSensorAttributes{
+		DataSource:  linux.DataSrcDbus,
+		Description: s.unit.Description,
+		LoadState:   s.unit.LoadState,
+		SubState:    s.unit.SubState,
+		Bus:         "system",
+	}
+	if s.unit.User {
+		attrs.Bus = "session"
+	}
+	return attrs
+}
+
+func newUnitSensor(unit *Unit) *unitSensor {
+	s := &unitSensor{unit: unit}
+	s.Value = unit.ActiveState
+	s.SensorTypeValue = linux.SensorUnitState
+	s.SensorSrc = linux.DataSrcDbus
+	return s
+}
+
+type failedUnitsSensor struct {
+	units []string
+	linux.Sensor
+}
+
+type failedUnitsSensorAttributes struct {
+	DataSource string   `json:"Data Source"`
+	Units      []string `json:"Units"`
+}
+
+func (s *failedUnitsSensor) Attributes() any {
+	return &failedUnitsSensorAttributes{
+		DataSource: linux.DataSrcDbus,
+		Units:      s.units,
+	}
+}
+
+func (s *failedUnitsSensor) Icon() string {
+	if len(s.units) > 0 {
+		return "mdi:alert-circle"
+	}
+	return "mdi:check-circle"
+}
+
+func newFailedUnitsSensor(user bool, units []string) *failedUnitsSensor {
+	s := &failedUnitsSensor{units: units}
+	s.Value = len(units)
+	s.SensorTypeValue = linux.SensorFailedUnits
+	if user {
+		s.SensorTypeValue = linux.SensorFailedUserUnits
+	}
+	s.SensorSrc = linux.DataSrcDbus
+	s.StateClassValue = sensor.StateMeasurement
+	return s
+}
+
+// Updater reports the state of the system and user units set in the
+// preferences, updated as it changes, and the count of failed system and user
+// units, with their names as attributes.
+func Updater(ctx context.Context) chan tracker.Sensor {
+	sensorCh := make(chan tracker.Sensor)
+	prefs := preferences.FetchFromContext(ctx)
+
+	// Unit changes are sent from D-Bus signal handlers, which may still run
+	// after the context is canceled, so sending and closing are serialized.
+	var mu sync.Mutex
+	closed := false
+	send := func(s tracker.Sensor) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case sensorCh <- s:
+		case <-ctx.Done():
+		}
+	}
+	updateFailed := func(_ time.Duration) {
+		for _, user := range []bool{false, true} {
+			units, err := ListFailedUnits(ctx, user)
+			if err != nil {
+				log.Debug().Err(err).Bool("user", user).Msg("Could not list failed units.")
+				continue
+			}
+			send(newFailedUnitsSensor(user, units))
+		}
+	}
+	watch := func(user bool, names []string) {
+		for _, name := range names {
+			unit, err := GetUnit(ctx, user, name)
+			if err != nil {
+				log.Warn().Err(err).Str("unit", name).Msg("Could not get unit state.")
+				continue
+			}
+			send(newUnitSensor(unit))
+			if err := WatchUnit(ctx, user, name, func(u *Unit) {
+				send(newUnitSensor(u))
+				if u.ActiveState == activeStateFailed {
+					updateFailed(0)
+				}
+			}); err != nil {
+				log.Warn().Err(err).Str("unit", name).Msg("Could not watch unit.")
+			}
+		}
+	}
+
+	go func() {
+		watch(false, prefs.Systemd.SystemUnits)
+		watch(true, prefs.Systemd.UserUnits)
+	}()
+	go helpers.PollSensors(ctx, updateFailed, failedUnitsPollInterval, time.Second)
+	go func() {
+		<-ctx.Done()
+		mu.Lock()
+		closed = true
+		close(sensorCh)
+		mu.Unlock()
+		log.Debug().Msg("Stopped systemd unit sensors.")
+	}()
+	return sensorCh
+}
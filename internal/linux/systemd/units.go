@@ -0,0 +1,209 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+// Package systemd reports the state of, and controls, systemd units through
+// the org.freedesktop.systemd1 D-Bus interface. System units are managed over
+// the system bus and user units over the session bus.
+package systemd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/joshuar/go-hass-agent/pkg/linux/dbusx"
+)
+
+const (
+	systemdDBusDest      = "org.freedesktop.systemd1"
+	systemdDBusPath      = "/org/freedesktop/systemd1"
+	managerInterface     = systemdDBusDest + ".Manager"
+	unitInterface        = systemdDBusDest + ".Unit"
+	loadUnitMethod       = managerInterface + ".LoadUnit"
+	listUnitsMethod      = managerInterface + ".ListUnitsFiltered"
+	subscribeMethod      = managerInterface + ".Subscribe"
+	startUnitMethod      = managerInterface + ".StartUnit"
+	stopUnitMethod       = managerInterface + ".StopUnit"
+	restartUnitMethod    = managerInterface + ".RestartUnit"
+	jobModeReplace       = "replace"
+	activeStateActive    = "active"
+	activeStateReloading = "reloading"
+	activeStateFailed    = "failed"
+)
+
+// Unit is the state of a systemd unit.
+type Unit struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	LoadState   string `json:"load_state"`
+	ActiveState string `json:"active_state"`
+	SubState    string `json:"sub_state"`
+	User        bool   `json:"user"`
+}
+
+// Running returns whether the unit is active (or reloading).
+func (u *Unit) Running() bool {
+	return u.ActiveState == activeStateActive || u.ActiveState == activeStateReloading
+}
+
+// UnitID converts the name of a unit into a form that can be used in IDs (e.g.,
+// syncthing.service becomes syncthing_service).
+func UnitID(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, name)
+}
+
+// GetUnit returns the current state of the unit with the given name. If user is
+// true, the unit is a user unit.
+func GetUnit(ctx context.Context, user bool, name string) (*Unit, error) {
+	path, err := unitPath(ctx, user, name)
+	if err != nil {
+		return nil, err
+	}
+	return getUnit(ctx, user, name, path)
+}
+
+// WatchUnit calls the given function with the state of the unit with the given
+// name whenever it changes, until the context is canceled. If user is true,
+// the unit is a user unit.
+func WatchUnit(ctx context.Context, user bool, name string, changed func(*Unit)) error {
+	path, err := unitPath(ctx, user, name)
+	if err != nil {
+		return err
+	}
+	// systemd only sends signals for units once a client has subscribed.
+	if err := dbusx.NewBusRequest(ctx, bus(user, dbusx.SystemBus, dbusx.SessionBus)).
+		Path(systemdDBusPath).
+		Destination(systemdDBusDest).
+		Call(subscribeMethod); err != nil {
+		return err
+	}
+	return dbusx.NewBusRequest(ctx, bus(user, dbusx.SystemBus, dbusx.SessionBus)).
+		Match([]dbus.MatchOption{
+			dbus.WithMatchObjectPath(path),
+			dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+			dbus.WithMatchMember("PropertiesChanged"),
+		}).
+		Handler(func(s *dbus.Signal) {
+			if s.Path != path || s.Name != dbusx.PropChangedSignal || len(s.Body) < 2 {
+				return
+			}
+			if intr, ok := s.Body[0].(string); !ok || intr != unitInterface {
+				return
+			}
+			props, ok := s.Body[1].(map[string]dbus.Variant)
+			if !ok {
+				return
+			}
+			if _, ok := props["ActiveState"]; !ok {
+				if _, ok := props["SubState"]; !ok {
+					return
+				}
+			}
+			if unit, err := getUnit(ctx, user, name, path); err == nil {
+				changed(unit)
+			}
+		}).
+		AddWatch(ctx)
+}
+
+// ListFailedUnits returns the names of the units that have failed. If user is
+// true, user units are listed.
+func ListFailedUnits(ctx context.Context, user bool) ([]string, error) {
+	data, ok := dbusx.NewBusRequest(ctx, bus(user, dbusx.SystemBus, dbusx.SessionBus)).
+		Path(systemdDBusPath).
+		Destination(systemdDBusDest).
+		GetData(listUnitsMethod, []string{activeStateFailed}).
+		AsRawInterface().([][]any)
+	if !ok {
+		return nil, errors.New("could not list failed units")
+	}
+	units := make([]string, 0, len(data))
+	for _, fields := range data {
+		if len(fields) == 0 {
+			continue
+		}
+		if name, ok := fields[0].(string); ok {
+			units = append(units, name)
+		}
+	}
+	return units, nil
+}
+
+// StartUnit starts the unit with the given name. If user is true, the unit is a
+// user unit.
+func StartUnit(ctx context.Context, user bool, name string) error {
+	return manage(ctx, user, startUnitMethod, name)
+}
+
+// StopUnit stops the unit with the given name. If user is true, the unit is a
+// user unit.
+func StopUnit(ctx context.Context, user bool, name string) error {
+	return manage(ctx, user, stopUnitMethod, name)
+}
+
+// RestartUnit restarts the unit with the given name. If user is true, the unit
+// is a user unit.
+func RestartUnit(ctx context.Context, user bool, name string) error {
+	return manage(ctx, user, restartUnitMethod, name)
+}
+
+func manage(ctx context.Context, user bool, method, name string) error {
+	return dbusx.NewBusRequest(ctx, bus(user, dbusx.SystemBus, dbusx.SessionBus)).
+		Path(systemdDBusPath).
+		Destination(systemdDBusDest).
+		Call(method, name, jobModeReplace)
+}
+
+// unitPath returns the D-Bus object path of the unit with the given name,
+// loading the unit if needed.
+func unitPath(ctx context.Context, user bool, name string) (dbus.ObjectPath, error) {
+	path := dbusx.NewBusRequest(ctx, bus(user, dbusx.SystemBus, dbusx.SessionBus)).
+		Path(systemdDBusPath).
+		Destination(systemdDBusDest).
+		GetData(loadUnitMethod, name).
+		AsObjectPath()
+	if path == "" {
+		return "", errors.New("could not find unit " + name)
+	}
+	return path, nil
+}
+
+func getUnit(ctx context.Context, user bool, name string, path dbus.ObjectPath) (*Unit, error) {
+	unit := &Unit{Name: name, User: user}
+	props := map[string]*string{
+		"Description": &unit.Description,
+		"LoadState":   &unit.LoadState,
+		"ActiveState": &unit.ActiveState,
+		"SubState":    &unit.SubState,
+	}
+	for prop, value := range props {
+		v, err := dbusx.NewBusRequest(ctx, bus(user, dbusx.SystemBus, dbusx.SessionBus)).
+			Path(path).
+			Destination(systemdDBusDest).
+			GetProp(unitInterface + "." + prop)
+		if err != nil {
+			return nil, err
+		}
+		*value = dbusx.VariantToValue[string](v)
+	}
+	return unit, nil
+}
+
+// bus returns the session bus for user units, otherwise the system bus. It is
+// generic so the bus type does not need to be named outside of dbusx.
+func bus[T any](user bool, system, session T) T {
+	if user {
+		return session
+	}
+	return system
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package systemd
+
+import "testing"
+
+func TestUnitID(t *testing.T) {
+	tests := []struct {
+		name string
+		unit string
+		want string
+	}{
+		{name: "service", unit: "syncthing.service", want: "syncthing_service"},
+		{name: "template instance", unit: "getty@tty1.service", want: "getty_tty1_service"},
+		{name: "mixed case and dashes", unit: "NetworkManager-wait-online.service", want: "networkmanager_wait_online_service"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnitID(tt.unit); got != tt.want {
+				t.Errorf("UnitID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
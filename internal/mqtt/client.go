@@ -0,0 +1,282 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+// Package mqtt provides the connection to the MQTT broker used by the agent. It
+// satisfies the client interface of go-hass-anything, adding support for an
+// availability topic (with a last will) that is kept up-to-date across
+// reconnections.
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	mqttapi "github.com/joshuar/go-hass-anything/v5/pkg/mqtt"
+)
+
+const (
+	// PayloadOnline is published to the availability topic when the agent is
+	// available.
+	PayloadOnline = "online"
+	// PayloadOffline is published to the availability topic when the agent is
+	// not available. It is also the last will of the client.
+	PayloadOffline = "offline"
+
+	// disconnectQuiesce is how long (in milliseconds) to wait for any
+	// in-flight messages when disconnecting.
+	disconnectQuiesce = 250
+)
+
+var ErrNotConnected = errors.New("not connected to MQTT broker")
+
+// Preferences are the preferences required to connect to the broker.
+type Preferences interface {
+	MQTTServer() string
+	MQTTUser() string
+	MQTTPassword() string
+	MQTTCAFile() string
+	MQTTClientCert() string
+	MQTTClientKey() string
+	MQTTInsecureSkipVerify() bool
+	MQTTClientID() string
+	MQTTKeepAlive() time.Duration
+	MQTTCleanSession() bool
+}
+
+// Client is a connection to an MQTT broker.
+type Client struct {
+	conn              MQTT.Client
+	subs              map[string]*mqttapi.Subscription
+	availabilityTopic string
+	connectFuncs      []func()
+	mu                sync.Mutex
+	online            bool
+}
+
+// Publish will send the given messages to the broker. Any error in publishing
+// will be returned.
+func (c *Client) Publish(msgs ...*mqttapi.Msg) error {
+	if !c.conn.IsConnected() {
+		return ErrNotConnected
+	}
+	for _, msg := range msgs {
+		log.Trace().Str("topic", msg.Topic).Bool("retain", msg.Retained).Msg("Publishing message.")
+		if token := c.conn.Publish(msg.Topic, msg.QOS, msg.Retained, []byte(msg.Message)); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+	}
+	return nil
+}
+
+// Subscribe will listen on the topics of the given subscriptions, passing any
+// received messages to their callback functions. Subscriptions are restored
+// whenever the client reconnects to the broker. Any error in setting up a
+// subscription will be returned.
+func (c *Client) Subscribe(subs ...*mqttapi.Subscription) error {
+	c.mu.Lock()
+	for _, sub := range subs {
+		c.subs[sub.Topic] = sub
+	}
+	c.mu.Unlock()
+	if !c.conn.IsConnected() {
+		return ErrNotConnected
+	}
+	return c.subscribe(subs...)
+}
+
+func (c *Client) subscribe(subs ...*mqttapi.Subscription) error {
+	for _, sub := range subs {
+		log.Trace().Str("topic", sub.Topic).Msg("Adding subscription.")
+		if token := c.conn.Subscribe(sub.Topic, sub.QOS, sub.Callback); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+	}
+	return nil
+}
+
+// AvailabilityTopic returns the topic on which the availability of the agent
+// is published.
+func (c *Client) AvailabilityTopic() string {
+	return c.availabilityTopic
+}
+
+// SetAvailability publishes whether the agent is available (online) or not
+// (offline). The availability is published again whenever the client
+// reconnects to the broker.
+func (c *Client) SetAvailability(online bool) error {
+	c.mu.Lock()
+	c.online = online
+	c.mu.Unlock()
+	return c.publishAvailability(online)
+}
+
+func (c *Client) publishAvailability(online bool) error {
+	payload := PayloadOffline
+	if online {
+		payload = PayloadOnline
+	}
+	log.Debug().Str("availability", payload).Msg("Publishing MQTT availability.")
+	return c.Publish(mqttapi.NewMsg(c.availabilityTopic, []byte(payload)).Retain())
+}
+
+// Disconnect will publish that the agent is offline and then disconnect from
+// the broker.
+func (c *Client) Disconnect() {
+	if err := c.SetAvailability(false); err != nil {
+		log.Warn().Err(err).Msg("Could not publish MQTT availability.")
+	}
+	c.conn.Disconnect(disconnectQuiesce)
+	log.Debug().Msg("Disconnected from MQTT.")
+}
+
+// OnConnect adds a function to call whenever the client reconnects to the
+// broker, once any subscriptions and the availability of the agent have been
+// restored. It can be used to publish again anything the broker may have lost.
+func (c *Client) OnConnect(f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connectFuncs = append(c.connectFuncs, f)
+}
+
+// onConnect restores any subscriptions and the availability of the agent after
+// (re)connecting to the broker, then calls any functions added with OnConnect.
+func (c *Client) onConnect(_ MQTT.Client) {
+	c.mu.Lock()
+	subs := make([]*mqttapi.Subscription, 0, len(c.subs))
+	for _, sub := range c.subs {
+		subs = append(subs, sub)
+	}
+	online := c.online
+	connectFuncs := slices.Clone(c.connectFuncs)
+	c.mu.Unlock()
+
+	// The connection is established, but the client may not be marked as
+	// connected until this handler returns, so run in the background.
+	go func() {
+		if err := c.subscribe(subs...); err != nil {
+			log.Warn().Err(err).Msg("Could not restore MQTT subscriptions.")
+		}
+		if online {
+			if err := c.publishAvailability(true); err != nil {
+				log.Warn().Err(err).Msg("Could not publish MQTT availability.")
+			}
+		}
+		for _, f := range connectFuncs {
+			f()
+		}
+	}()
+}
+
+// NewClient will establish a new connection to the MQTT broker in the given
+// preferences. The last will of the client marks the agent as offline on the
+// given availability topic. Call SetAvailability once the agent is ready to
+// mark it as online.
+func NewClient(ctx context.Context, prefs Preferences, availabilityTopic string) (*Client, error) {
+	clientID := prefs.MQTTClientID()
+	if clientID == "" {
+		hostname, _ := os.Hostname()
+		clientID = hostname + strconv.Itoa(time.Now().Second())
+	}
+
+	tlsConfig, err := newTLSConfig(prefs)
+	if err != nil {
+		return nil, fmt.Errorf("could not configure TLS: %w", err)
+	}
+
+	client := &Client{
+		subs:              make(map[string]*mqttapi.Subscription),
+		availabilityTopic: availabilityTopic,
+	}
+
+	connOpts := MQTT.NewClientOptions().
+		AddBroker(prefs.MQTTServer()).
+		SetClientID(clientID).
+		SetCleanSession(prefs.MQTTCleanSession()).
+		SetTLSConfig(tlsConfig).
+		SetWill(availabilityTopic, PayloadOffline, 1, true).
+		SetOnConnectHandler(client.onConnect).
+		SetConnectionLostHandler(func(_ MQTT.Client, err error) {
+			log.Warn().Err(err).Msg("Lost connection to MQTT broker. Reconnecting.")
+		})
+	if prefs.MQTTUser() != "" {
+		connOpts.SetUsername(prefs.MQTTUser())
+		if prefs.MQTTPassword() != "" {
+			connOpts.SetPassword(prefs.MQTTPassword())
+		}
+	}
+	if keepAlive := prefs.MQTTKeepAlive(); keepAlive > 0 {
+		connOpts.SetKeepAlive(keepAlive)
+	}
+	client.conn = MQTT.NewClient(connOpts)
+
+	connect := func() error {
+		if token := client.conn.Connect(); token.Wait() && token.Error() != nil {
+			return token.Error()
+		}
+		return nil
+	}
+	if err := backoff.Retry(connect, backoff.WithContext(backoff.NewExponentialBackOff(), ctx)); err != nil {
+		return nil, err
+	}
+
+	log.Debug().Msgf("Connected to MQTT server %s.", prefs.MQTTServer())
+	return client, nil
+}
+
+// newTLSConfig creates the TLS config for connecting to the broker. The
+// certificate of the broker is verified against the system CAs and any CA
+// bundle in the preferences. If a client certificate is in the preferences, it
+// is presented to the broker. The TLS config is only used by paho for ssl://,
+// tls:// and mqtts:// broker URIs.
+func newTLSConfig(prefs Preferences) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: prefs.MQTTInsecureSkipVerify(),
+	}
+	if tlsConfig.InsecureSkipVerify {
+		log.Warn().Msg("MQTT broker certificate will not be verified.")
+	}
+
+	if caFile := prefs.MQTTCAFile(); caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := prefs.MQTTClientCert(), prefs.MQTTClientKey()
+	switch {
+	case certFile != "" && keyFile != "":
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case certFile != "" || keyFile != "":
+		return nil, errors.New("both a client certificate and key are required")
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package mqtt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testPrefs struct {
+	caFile, clientCert, clientKey string
+	insecure                      bool
+}
+
+func (p *testPrefs) MQTTServer() string           { return "ssl://localhost:8883" }
+func (p *testPrefs) MQTTUser() string             { return "" }
+func (p *testPrefs) MQTTPassword() string         { return "" }
+func (p *testPrefs) MQTTCAFile() string           { return p.caFile }
+func (p *testPrefs) MQTTClientCert() string       { return p.clientCert }
+func (p *testPrefs) MQTTClientKey() string        { return p.clientKey }
+func (p *testPrefs) MQTTInsecureSkipVerify() bool { return p.insecure }
+func (p *testPrefs) MQTTClientID() string         { return "" }
+func (p *testPrefs) MQTTKeepAlive() time.Duration { return 0 }
+func (p *testPrefs) MQTTCleanSession() bool       { return true }
+
+func Test_newTLSConfig(t *testing.T) {
+	invalidCA := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(invalidCA, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		prefs        *testPrefs
+		name         string
+		wantErr      bool
+		wantInsecure bool
+	}{
+		{
+			name:  "defaults",
+			prefs: &testPrefs{},
+		},
+		{
+			name:         "insecure",
+			prefs:        &testPrefs{insecure: true},
+			wantInsecure: true,
+		},
+		{
+			name:    "missing CA file",
+			prefs:   &testPrefs{caFile: filepath.Join(t.TempDir(), "missing.pem")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid CA file",
+			prefs:   &testPrefs{caFile: invalidCA},
+			wantErr: true,
+		},
+		{
+			name:    "client certificate without key",
+			prefs:   &testPrefs{clientCert: "client.crt"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid client certificate",
+			prefs:   &testPrefs{clientCert: invalidCA, clientKey: invalidCA},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTLSConfig(tt.prefs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != nil && got.InsecureSkipVerify != tt.wantInsecure {
+				t.Errorf("newTLSConfig() InsecureSkipVerify = %v, want %v", got.InsecureSkipVerify, tt.wantInsecure)
+			}
+		})
+	}
+}
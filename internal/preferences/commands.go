@@ -0,0 +1,115 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package preferences
+
+import (
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/iancoleman/strcase"
+)
+
+// The types of user-defined MQTT commands. Each is published as the Home
+// Assistant entity of the same name.
+const (
+	MQTTCommandButton = "button"
+	MQTTCommandSwitch = "switch"
+	MQTTCommandText   = "text"
+	MQTTCommandNumber = "number"
+)
+
+// defaultMQTTCooldown is the default minimum time (in seconds) between presses
+// of a button for a destructive action or user-defined command that will be
+// acted on.
+const defaultMQTTCooldown = 5
+
+// MQTTConfig holds the MQTT preferences that are written as tables under a
+// [mqtt] section of the preferences file, rather than as single keys.
+type MQTTConfig struct {
+	// Disabled lists the IDs of controls that are not added to Home Assistant
+	// and whose commands are ignored.
+	Disabled []string `toml:"disabled,omitempty"`
+	// Commands must have unique IDs (see MQTTCommand.ID), which also makes
+	// their names unique.
+	Commands []MQTTCommand `toml:"commands,omitempty" validate:"dive"`
+	// Cooldown is the minimum time (in seconds) between presses of a button
+	// for a destructive action (e.g., reboot) or user-defined command that will
+	// be acted on.
+	Cooldown int `toml:"cooldown" validate:"gte=0"`
+	// ConfirmTimeout is how long (in seconds) the user has to confirm an
+	// action before it is cancelled. If zero, a default timeout is used.
+	ConfirmTimeout int `toml:"confirm_timeout,omitempty" validate:"gte=0"`
+	// InhibitWhat, InhibitWhy and InhibitMode set the actions, reason and mode
+	// of the inhibitor lock taken when the inhibit switch is on. If empty,
+	// defaults are used.
+	InhibitWhat string `toml:"inhibit_what,omitempty" validate:"omitempty,printascii"`
+	InhibitWhy  string `toml:"inhibit_why,omitempty"`
+	InhibitMode string `toml:"inhibit_mode,omitempty" validate:"omitempty,oneof=block delay"`
+	// Confirm sets whether the user must confirm, on the device, any reboot,
+	// power off or lock actions before they are run.
+	Confirm bool `toml:"confirm,omitempty"`
+}
+
+// MQTTCommand is a user-defined command, declared in a [[mqtt.commands]] table
+// of the preferences file, that is published as an entity over MQTT. Commands
+// are lists of the program to run and its arguments. They are not run through a
+// shell.
+type MQTTCommand struct {
+	// Min, Max and Step set the range of a number.
+	Min  *float64 `toml:"min,omitempty"`
+	Max  *float64 `toml:"max,omitempty" validate:"omitempty,required_with=Min,gtfield=Min"`
+	Step *float64 `toml:"step,omitempty" validate:"omitempty,gt=0"`
+	Name string   `toml:"name" validate:"required"`
+	Type string   `toml:"type" validate:"required,oneof=button switch text number"`
+	Icon string   `toml:"icon,omitempty"`
+	// Units are the units of a number.
+	Units string `toml:"units,omitempty"`
+	// ValueEnv is the environment variable in which the value of a text or
+	// number is passed to the command. If empty, the value is passed as the
+	// last argument.
+	ValueEnv string `toml:"value_env,omitempty" validate:"omitempty,excludesall=="`
+	// Command is run when a button is pressed or a text or number is set.
+	Command []string `toml:"command,omitempty" validate:"required_unless=Type switch"`
+	// OnCommand and OffCommand are run when a switch is turned on or off.
+	OnCommand  []string `toml:"on_command,omitempty" validate:"required_if=Type switch"`
+	OffCommand []string `toml:"off_command,omitempty" validate:"required_if=Type switch"`
+	// StateCommand is run to find the state of a switch, which is on if it
+	// exits successfully. It is run after the switch is turned on or off and,
+	// if StateInterval is set, every StateInterval seconds. If not set, the
+	// switch state is assumed from the last command run.
+	StateCommand  []string `toml:"state_command,omitempty"`
+	StateInterval int      `toml:"state_interval,omitempty" validate:"gte=0"`
+	// ReportOutput sets whether the output and exit status of the last command
+	// run are reported as attributes of the entity.
+	ReportOutput bool `toml:"report_output,omitempty"`
+	// Confirm sets whether the user must confirm, on the device, that the
+	// command should be run.
+	Confirm bool `toml:"confirm,omitempty"`
+}
+
+// ID returns the ID of the entity for the command, which is derived from its
+// name.
+func (c *MQTTCommand) ID() string {
+	return "command_" + strcase.ToSnake(c.Name)
+}
+
+// validateMQTTConfig checks that the commands have unique IDs. Names that
+// differ only in case or separators (e.g., "Foo Bar" and "foo_bar") have the
+// same ID, and would replace each other in Home Assistant.
+func validateMQTTConfig(sl validator.StructLevel) {
+	cfg, ok := sl.Current().Interface().(MQTTConfig)
+	if !ok {
+		return
+	}
+	seen := make(map[string]bool, len(cfg.Commands))
+	for i := range cfg.Commands {
+		id := cfg.Commands[i].ID()
+		if seen[id] {
+			sl.ReportError(cfg.Commands[i].Name, fmt.Sprintf("Commands[%d].Name", i), "Name", "unique_id", id)
+		}
+		seen[id] = true
+	}
+}
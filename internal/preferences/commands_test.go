@@ -0,0 +1,172 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package preferences
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMQTTCommands(t *testing.T) {
+	base := `'agent.version' = '6.4.0'
+'registration.host' = 'http://test.host:9999'
+'registration.token' = 'testToken'
+'device.id' = 'testID'
+'device.name' = 'testDevice'
+'hass.apiurl' = 'http://test.host:9999'
+'hass.websocketurl' = 'http://test.host:9999'
+'hass.webhookid' = 'testID'
+'mqtt.enabled' = true
+`
+	tests := []struct {
+		name         string
+		commands     string
+		wantCommands int
+		wantErr      bool
+	}{
+		{
+			name:         "none",
+			wantCommands: 0,
+		},
+		{
+			name: "valid",
+			commands: `
+[[mqtt.commands]]
+name = 'Restart Player'
+type = 'button'
+command = ['systemctl', '--user', 'restart', 'player']
+
+[[mqtt.commands]]
+name = 'VPN'
+type = 'switch'
+on_command = ['nmcli', 'connection', 'up', 'vpn']
+off_command = ['nmcli', 'connection', 'down', 'vpn']
+state_command = ['nmcli', '-g', 'GENERAL.STATE', 'connection', 'show', 'vpn']
+state_interval = 60
+
+[[mqtt.commands]]
+name = 'Notify'
+type = 'text'
+command = ['notify-send', 'Home Assistant']
+
+[[mqtt.commands]]
+name = 'Volume'
+type = 'number'
+command = ['set-volume']
+value_env = 'VOLUME'
+min = 0
+max = 100
+step = 5
+`,
+			wantCommands: 4,
+		},
+		{
+			name: "unknown type",
+			commands: `
+[[mqtt.commands]]
+name = 'Bad'
+type = 'light'
+command = ['true']
+`,
+			wantCommands: 1,
+			wantErr:      true,
+		},
+		{
+			name: "button without command",
+			commands: `
+[[mqtt.commands]]
+name = 'Bad'
+type = 'button'
+`,
+			wantCommands: 1,
+			wantErr:      true,
+		},
+		{
+			name: "switch without off command",
+			commands: `
+[[mqtt.commands]]
+name = 'Bad'
+type = 'switch'
+on_command = ['true']
+`,
+			wantCommands: 1,
+			wantErr:      true,
+		},
+		{
+			name: "duplicate names",
+			commands: `
+[[mqtt.commands]]
+name = 'Same'
+type = 'button'
+command = ['true']
+
+[[mqtt.commands]]
+name = 'Same'
+type = 'button'
+command = ['false']
+`,
+			wantCommands: 2,
+			wantErr:      true,
+		},
+		{
+			name: "duplicate ids",
+			commands: `
+[[mqtt.commands]]
+name = 'Foo Bar'
+type = 'button'
+command = ['true']
+
+[[mqtt.commands]]
+name = 'foo_bar'
+type = 'button'
+command = ['false']
+`,
+			wantCommands: 2,
+			wantErr:      true,
+		},
+		{
+			name: "number range reversed",
+			commands: `
+[[mqtt.commands]]
+name = 'Bad'
+type = 'number'
+command = ['true']
+min = 10
+max = 1
+`,
+			wantCommands: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			SetPath(dir)
+			err := os.WriteFile(filepath.Join(dir, preferencesFile), []byte(base+tt.commands), 0o600)
+			assert.Nil(t, err)
+
+			prefs, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			assert.Len(t, prefs.MQTT.Commands, tt.wantCommands)
+			if err := validatePreferences(prefs); (err != nil) != tt.wantErr {
+				t.Errorf("validatePreferences() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			// Saving other preferences should keep the commands.
+			assert.Nil(t, Save(MQTTServer("tcp://localhost:1883")))
+			prefs, err = Load()
+			assert.Nil(t, err)
+			assert.Len(t, prefs.MQTT.Commands, tt.wantCommands)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package preferences
+
+// DiskConfig holds the preferences, written under a [disk] section of the
+// preferences file, for the disk sensors.
+type DiskConfig struct {
+	// Filesystems and ExcludeFilesystems are the filesystem types (e.g.,
+	// "ext4") of the mounts with usage sensors. A mount is reported if its
+	// type is in Filesystems (or, if it is empty, any type) and not in
+	// ExcludeFilesystems. If ExcludeFilesystems is not set, squashfs (e.g.,
+	// snaps) is excluded.
+	Filesystems        []string `toml:"filesystems,omitempty" validate:"dive,required"`
+	ExcludeFilesystems []string `toml:"exclude_filesystems,omitempty" validate:"dive,required"`
+	// Mountpoints and ExcludeMountpoints are shell patterns (e.g.,
+	// "/media/*") matched against mountpoints to choose the mounts with usage
+	// sensors. A pattern that matches a directory also matches any mount
+	// under it. A mount is reported if it matches a Mountpoints pattern (or,
+	// if there are none, any mountpoint) and does not match an
+	// ExcludeMountpoints pattern.
+	Mountpoints        []string `toml:"mountpoints,omitempty" validate:"dive,required"`
+	ExcludeMountpoints []string `toml:"exclude_mountpoints,omitempty" validate:"dive,required"`
+	// Devices and ExcludeDevices are shell patterns (e.g., "nvme*") matched
+	// against block device names to choose the devices with I/O sensors. A
+	// device is reported if it matches a Devices pattern (or, if there are
+	// none, any name) and does not match an ExcludeDevices pattern. If
+	// ExcludeDevices is not set, loop and RAM (including zram) devices are
+	// excluded.
+	Devices        []string `toml:"devices,omitempty" validate:"dive,required"`
+	ExcludeDevices []string `toml:"exclude_devices,omitempty" validate:"dive,required"`
+	// Partitions sets whether partitions are reported as well as whole
+	// devices.
+	Partitions bool `toml:"partitions,omitempty"`
+}
@@ -5,6 +5,8 @@
 
 package preferences
 
+import "time"
+
 // MQTTPrefereneces encapsulates Preferences so it can be passed to an MQTT
 // client and satisfy the config interface that code requires.
 type MQTTPreferences struct {
@@ -32,3 +34,45 @@ func (p *MQTTPreferences) MQTTUser() string {
 func (p *MQTTPreferences) MQTTPassword() string {
 	return p.Prefs.MQTTPassword
 }
+
+// MQTTCAFile returns the path to any CA bundle used to verify the broker
+// certificate from the preferences.
+func (p *MQTTPreferences) MQTTCAFile() string {
+	return p.Prefs.MQTTCAFile
+}
+
+// MQTTClientCert returns the path to any client certificate used to
+// authenticate with the broker from the preferences.
+func (p *MQTTPreferences) MQTTClientCert() string {
+	return p.Prefs.MQTTClientCert
+}
+
+// MQTTClientKey returns the path to the private key of any client certificate
+// from the preferences.
+func (p *MQTTPreferences) MQTTClientKey() string {
+	return p.Prefs.MQTTClientKey
+}
+
+// MQTTInsecureSkipVerify returns whether verification of the broker
+// certificate should be skipped from the preferences.
+func (p *MQTTPreferences) MQTTInsecureSkipVerify() bool {
+	return p.Prefs.MQTTInsecureSkipVerify
+}
+
+// MQTTClientID returns any client ID to use when connecting to the broker from
+// the preferences.
+func (p *MQTTPreferences) MQTTClientID() string {
+	return p.Prefs.MQTTClientID
+}
+
+// MQTTKeepAlive returns the keepalive interval for the connection to the
+// broker from the preferences. A zero value means the default should be used.
+func (p *MQTTPreferences) MQTTKeepAlive() time.Duration {
+	return time.Duration(p.Prefs.MQTTKeepAlive) * time.Second
+}
+
+// MQTTCleanSession returns whether a clean session should be requested when
+// connecting to the broker from the preferences.
+func (p *MQTTPreferences) MQTTCleanSession() bool {
+	return p.Prefs.MQTTCleanSession
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package preferences
+
+// NetworkConfig holds the preferences, written under a [network] section of the
+// preferences file, for the network sensors.
+type NetworkConfig struct {
+	// Include and Exclude are shell patterns (e.g., "wl*") matched against
+	// interface names to choose the interfaces with their own sensors. An
+	// interface is reported if it matches an Include pattern (or, if there
+	// are none, is a physical or VPN interface) and does not match an Exclude
+	// pattern. If Exclude is not set, a default list of virtual interfaces is
+	// excluded.
+	Include []string `toml:"include,omitempty" validate:"dive,required"`
+	Exclude []string `toml:"exclude,omitempty" validate:"dive,required"`
+	// BillingDay is the day of the month on which the monthly data usage is
+	// reset. If zero, it is reset on the first day of the month.
+	BillingDay int `toml:"billing_day,omitempty" validate:"gte=0,lte=28"`
+}
@@ -28,27 +28,40 @@ var AppVersion string
 var (
 	preferencesPath = filepath.Join(xdg.ConfigHome, "go-hass-agent")
 	preferencesFile = "preferences.toml"
+	statePath       = filepath.Join(xdg.StateHome, "go-hass-agent")
 )
 
 type Preferences struct {
-	mu             *sync.Mutex
-	Version        string `toml:"agent.version" validate:"required"`
-	Host           string `toml:"registration.host" validate:"required,http_url"`
-	Token          string `toml:"registration.token" validate:"required,ascii"`
-	DeviceID       string `toml:"device.id" validate:"required,ascii"`
-	DeviceName     string `toml:"device.name" validate:"required,hostname"`
-	RestAPIURL     string `toml:"hass.apiurl,omitempty" validate:"http_url,required_without=CloudhookURL RemoteUIURL"`
-	CloudhookURL   string `toml:"hass.cloudhookurl,omitempty" validate:"omitempty,http_url"`
-	WebsocketURL   string `toml:"hass.websocketurl" validate:"required,url"`
-	WebhookID      string `toml:"hass.webhookid" validate:"required,ascii"`
-	RemoteUIURL    string `toml:"hass.remoteuiurl,omitempty" validate:"omitempty,http_url"`
-	Secret         string `toml:"hass.secret,omitempty" validate:"omitempty"`
-	MQTTPassword   string `toml:"mqtt.password,omitempty" validate:"omitempty"`
-	MQTTUser       string `toml:"mqtt.user,omitempty" validate:"omitempty"`
-	MQTTServer     string `toml:"mqtt.server,omitempty" validate:"omitempty,uri"`
-	Registered     bool   `toml:"hass.registered" validate:"boolean"`
-	MQTTEnabled    bool   `toml:"mqtt.enabled" validate:"boolean"`
-	MQTTRegistered bool   `toml:"mqtt.registered" validate:"boolean"`
+	mu                     *sync.Mutex
+	Version                string          `toml:"agent.version" validate:"required"`
+	Host                   string          `toml:"registration.host" validate:"required,http_url"`
+	Token                  string          `toml:"registration.token" validate:"required,ascii"`
+	DeviceID               string          `toml:"device.id" validate:"required,ascii"`
+	DeviceName             string          `toml:"device.name" validate:"required,hostname"`
+	RestAPIURL             string          `toml:"hass.apiurl,omitempty" validate:"http_url,required_without=CloudhookURL RemoteUIURL"`
+	CloudhookURL           string          `toml:"hass.cloudhookurl,omitempty" validate:"omitempty,http_url"`
+	WebsocketURL           string          `toml:"hass.websocketurl" validate:"required,url"`
+	WebhookID              string          `toml:"hass.webhookid" validate:"required,ascii"`
+	RemoteUIURL            string          `toml:"hass.remoteuiurl,omitempty" validate:"omitempty,http_url"`
+	Secret                 string          `toml:"hass.secret,omitempty" validate:"omitempty"`
+	MQTTPassword           string          `toml:"mqtt.password,omitempty" validate:"omitempty"`
+	MQTTUser               string          `toml:"mqtt.user,omitempty" validate:"omitempty"`
+	MQTTServer             string          `toml:"mqtt.server,omitempty" validate:"omitempty,uri"`
+	MQTTCAFile             string          `toml:"mqtt.cafile,omitempty" validate:"omitempty,filepath"`
+	MQTTClientCert         string          `toml:"mqtt.clientcert,omitempty" validate:"required_with=MQTTClientKey,omitempty,filepath"`
+	MQTTClientKey          string          `toml:"mqtt.clientkey,omitempty" validate:"required_with=MQTTClientCert,omitempty,filepath"`
+	MQTTClientID           string          `toml:"mqtt.clientid,omitempty" validate:"omitempty,printascii"`
+	MQTTKeepAlive          int             `toml:"mqtt.keepalive,omitempty" validate:"gte=0"`
+	Registered             bool            `toml:"hass.registered" validate:"boolean"`
+	MQTTEnabled            bool            `toml:"mqtt.enabled" validate:"boolean"`
+	MQTTSensors            bool            `toml:"mqtt.sensors" validate:"boolean"`
+	MQTTInsecureSkipVerify bool            `toml:"mqtt.insecureskipverify,omitempty" validate:"boolean"`
+	MQTTCleanSession       bool            `toml:"mqtt.cleansession" validate:"boolean"`
+	MQTT                   MQTTConfig      `toml:"mqtt,omitempty"`
+	Systemd                SystemdConfig   `toml:"systemd,omitempty"`
+	Processes              ProcessesConfig `toml:"processes,omitempty"`
+	Network                NetworkConfig   `toml:"network,omitempty"`
+	Disk                   DiskConfig      `toml:"disk,omitempty"`
 }
 
 type Preference func(*Preferences) error
@@ -71,6 +84,19 @@ func GetPath() string {
 	return preferencesPath
 }
 
+// SetStatePath sets the path to the directory in which the agent keeps its
+// state (e.g., logs and stored sensor values). If this function is not called,
+// a default path is used.
+func SetStatePath(path string) {
+	statePath = path
+}
+
+// GetStatePath returns the current path to the directory in which the agent
+// keeps its state.
+func GetStatePath() string {
+	return statePath
+}
+
 // GetFile returns the filename of the preferences file. Use GetPath to retrieve
 // its path.
 func GetFile() string {
@@ -189,17 +215,85 @@ func MQTTPassword(password string) Preference {
 	}
 }
 
-func MQTTRegistered(status bool) Preference {
+// MQTTSensors sets whether sensors are published over MQTT instead of being
+// sent to the Home Assistant mobile_app integration.
+func MQTTSensors(status bool) Preference {
+	return func(p *Preferences) error {
+		p.MQTTSensors = status
+		return nil
+	}
+}
+
+// MQTTCAFile sets the path to a PEM-encoded CA bundle used to verify the
+// certificate of the broker, in addition to the system CAs.
+func MQTTCAFile(path string) Preference {
+	return func(p *Preferences) error {
+		p.MQTTCAFile = path
+		return nil
+	}
+}
+
+// MQTTClientCert sets the path to a PEM-encoded client certificate used to
+// authenticate with the broker.
+func MQTTClientCert(path string) Preference {
+	return func(p *Preferences) error {
+		p.MQTTClientCert = path
+		return nil
+	}
+}
+
+// MQTTClientKey sets the path to the PEM-encoded private key of the client
+// certificate.
+func MQTTClientKey(path string) Preference {
+	return func(p *Preferences) error {
+		p.MQTTClientKey = path
+		return nil
+	}
+}
+
+// MQTTInsecureSkipVerify sets whether the certificate of the broker is
+// verified. It should only be used for testing.
+func MQTTInsecureSkipVerify(status bool) Preference {
+	return func(p *Preferences) error {
+		p.MQTTInsecureSkipVerify = status
+		return nil
+	}
+}
+
+// MQTTClientID sets the client ID used when connecting to the broker. If
+// empty, a client ID is generated.
+func MQTTClientID(id string) Preference {
+	return func(p *Preferences) error {
+		p.MQTTClientID = id
+		return nil
+	}
+}
+
+// MQTTKeepAlive sets the keepalive interval (in seconds) for the connection
+// to the broker. If zero, a default interval is used.
+func MQTTKeepAlive(seconds int) Preference {
+	return func(p *Preferences) error {
+		p.MQTTKeepAlive = seconds
+		return nil
+	}
+}
+
+// MQTTCleanSession sets whether a clean session is requested when connecting
+// to the broker.
+func MQTTCleanSession(status bool) Preference {
 	return func(p *Preferences) error {
-		p.MQTTRegistered = status
+		p.MQTTCleanSession = status
 		return nil
 	}
 }
 
 func defaultPreferences() *Preferences {
 	return &Preferences{
-		Version: AppVersion,
-		mu:      &sync.Mutex{},
+		Version:          AppVersion,
+		MQTTCleanSession: true,
+		MQTT:             MQTTConfig{Cooldown: defaultMQTTCooldown},
+		Processes:        ProcessesConfig{Top: defaultTopProcesses},
+		mu:               &sync.Mutex{},
 	}
 }
 
@@ -426,14 +426,20 @@ func Test_defaultPreferences(t *testing.T) {
 		{
 			name: "default returned",
 			want: &Preferences{
-				Version: AppVersion,
+				Version:          AppVersion,
+				MQTTCleanSession: true,
+				MQTT:             MQTTConfig{Cooldown: defaultMQTTCooldown},
+				Processes:        ProcessesConfig{Top: defaultTopProcesses},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := defaultPreferences()
-			assert.Equal(t, got.Version, AppVersion)
+			assert.Equal(t, got.Version, tt.want.Version)
+			assert.Equal(t, got.MQTTCleanSession, tt.want.MQTTCleanSession)
+			assert.Equal(t, got.MQTT, tt.want.MQTT)
+			assert.Equal(t, got.Processes, tt.want.Processes)
 		})
 	}
 }
@@ -0,0 +1,21 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package preferences
+
+// defaultTopProcesses is the default number of processes listed by the top
+// CPU and memory process sensors.
+const defaultTopProcesses = 5
+
+// ProcessesConfig holds the preferences, written under a [processes] section of
+// the preferences file, for the process sensors.
+type ProcessesConfig struct {
+	// Tracked are the names of processes (as shown in /proc/<pid>/comm) that
+	// are reported as running or not, with their CPU and memory usage.
+	Tracked []string `toml:"tracked,omitempty" validate:"unique,dive,required"`
+	// Top is the number of processes listed by the top CPU and memory
+	// process sensors. If zero, those sensors are not reported.
+	Top int `toml:"top" validate:"gte=0"`
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package preferences
+
+// SystemdConfig holds the preferences, written under a [systemd] section of the
+// preferences file, for the systemd units to report and control.
+type SystemdConfig struct {
+	// SystemUnits and UserUnits are the names of the system and user units
+	// whose state is reported as sensors.
+	SystemUnits []string `toml:"system_units,omitempty" validate:"unique,dive,required,printascii"`
+	UserUnits   []string `toml:"user_units,omitempty" validate:"unique,dive,required,printascii"`
+	// Controls are the names of the user units that can be started, stopped
+	// and restarted over MQTT.
+	Controls []string `toml:"controls,omitempty" validate:"unique,dive,required,printascii"`
+}
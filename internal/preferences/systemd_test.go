@@ -0,0 +1,93 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package preferences
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemdConfig(t *testing.T) {
+	base := `'agent.version' = '6.4.0'
+'registration.host' = 'http://test.host:9999'
+'registration.token' = 'testToken'
+'device.id' = 'testID'
+'device.name' = 'testDevice'
+'hass.apiurl' = 'http://test.host:9999'
+'hass.websocketurl' = 'http://test.host:9999'
+'hass.webhookid' = 'testID'
+`
+	tests := []struct {
+		name    string
+		systemd string
+		want    SystemdConfig
+		wantErr bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "valid",
+			systemd: `
+[systemd]
+system_units = ['sshd.service', 'docker.service']
+user_units = ['syncthing.service']
+controls = ['syncthing.service']
+`,
+			want: SystemdConfig{
+				SystemUnits: []string{"sshd.service", "docker.service"},
+				UserUnits:   []string{"syncthing.service"},
+				Controls:    []string{"syncthing.service"},
+			},
+		},
+		{
+			name: "duplicate units",
+			systemd: `
+[systemd]
+system_units = ['sshd.service', 'sshd.service']
+`,
+			want:    SystemdConfig{SystemUnits: []string{"sshd.service", "sshd.service"}},
+			wantErr: true,
+		},
+		{
+			name: "empty unit name",
+			systemd: `
+[systemd]
+controls = ['']
+`,
+			want:    SystemdConfig{Controls: []string{""}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			SetPath(dir)
+			err := os.WriteFile(filepath.Join(dir, preferencesFile), []byte(base+tt.systemd), 0o600)
+			assert.Nil(t, err)
+
+			prefs, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			assert.Equal(t, tt.want, prefs.Systemd)
+			if err := validatePreferences(prefs); (err != nil) != tt.wantErr {
+				t.Errorf("validatePreferences() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			// Saving other preferences should keep the units.
+			assert.Nil(t, Save(MQTTServer("tcp://localhost:1883")))
+			prefs, err = Load()
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, prefs.Systemd)
+		})
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 func validatePreferences(prefs *Preferences) error {
 	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterStructValidation(validateMQTTConfig, MQTTConfig{})
 	return validate.Struct(prefs)
 }
 
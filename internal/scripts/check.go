@@ -0,0 +1,150 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scripts
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+// CheckOptions control how scripts are run by Check.
+type CheckOptions struct {
+	// StreamDuration is how long streaming scripts are run for.
+	StreamDuration time.Duration
+	// RunCommands controls whether scripts that are only commands are run.
+	RunCommands bool
+}
+
+// Check runs the script at the given path and validates its schedule and
+// output the same way the agent would. It returns the valid sensors the script
+// output, along with an error describing every problem found. The script is
+// first probed as the agent would and then run as it would be on its schedule.
+// Streaming scripts are run for opts.StreamDuration (or until they exit) and
+// any sensors output in that time are checked. Scripts that are only commands
+// (with no schedule) are run as a command if opts.RunCommands is true.
+func Check(ctx context.Context, path string, opts CheckOptions) ([]tracker.Sensor, error) {
+	if !isExecutable(path) {
+		return nil, ErrNotExecutable
+	}
+	s := &script{
+		ctx:     ctx,
+		path:    path,
+		timeout: DefaultTimeout,
+	}
+	o, err := s.execute(triggerProbe)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems error
+	if err := s.configure(o); err != nil {
+		problems = errors.Join(problems, err)
+	}
+
+	if s.IsStreaming() {
+		s.timeout = opts.StreamDuration
+		sensors, err := s.checkStream()
+		return sensors, errors.Join(problems, err)
+	}
+
+	// Run the script as the agent would. Invalid schedules will have been
+	// reported when configuring the script.
+	trigger := triggerSchedule
+	switch events := s.Events(); {
+	case s.CronSpec() != "":
+	case len(events) > 0:
+		trigger = eventTrigger(events[0])
+	case s.Command() != nil:
+		if !opts.RunCommands {
+			return nil, problems
+		}
+		trigger = triggerCommand
+	case o.Schedule == "":
+		problems = errors.Join(problems, errors.New("schedule: a schedule is required"))
+	}
+
+	if o, err = s.execute(trigger); err != nil {
+		return nil, errors.Join(problems, err)
+	}
+	var sensors []tracker.Sensor
+	for _, sensor := range o.Sensors {
+		if err := sensor.validate(); err != nil {
+			problems = errors.Join(problems, fmt.Errorf("sensor %q: %w", sensor.SensorName, err))
+			continue
+		}
+		sensors = append(sensors, sensor)
+	}
+	if len(o.Sensors) == 0 && trigger != triggerCommand {
+		problems = errors.Join(problems, errors.New("script output contains no sensors"))
+	}
+	return sensors, problems
+}
+
+// checkStream runs a streaming script until its timeout and checks every line
+// of output it produces.
+func (s *script) checkStream() ([]tracker.Sensor, error) {
+	ctx, cancelFunc := context.WithTimeout(s.ctx, s.timeout)
+	defer cancelFunc()
+
+	cmd := s.command(ctx, triggerStream)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.start(cmd); err != nil {
+		return nil, err
+	}
+
+	var sensors []tracker.Sensor
+	var problems error
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxOutputSize)
+	for scanner.Scan() {
+		sensor, err := parseStreamSensor(scanner.Bytes())
+		switch {
+		case err != nil:
+			problems = errors.Join(problems, err)
+		case sensor != nil:
+			sensors = append(sensors, sensor)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		problems = errors.Join(problems, err)
+		cancelFunc()
+	}
+	// The script being stopped at the end of the duration is expected.
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		problems = errors.Join(problems, err)
+	}
+	if len(sensors) == 0 && problems == nil {
+		problems = fmt.Errorf("streaming script output no sensors within %s", s.timeout)
+	}
+	return sensors, problems
+}
+
+// validateSchedule checks that the given schedule is one the agent can use to
+// run a script. An empty schedule is valid, as scripts that are commands do not
+// need a schedule.
+func validateSchedule(schedule string) error {
+	spec, _, err := parseSchedule(schedule)
+	if err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+	if spec == "" {
+		return nil
+	}
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return fmt.Errorf("schedule: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scripts
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+)
+
+// scriptCommand is the optional metadata a script outputs to declare that it
+// can be run on demand as a command.
+type scriptCommand struct {
+	ID   string `json:"id,omitempty" yaml:"id,omitempty" toml:"id,omitempty"`
+	Name string `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+	Icon string `json:"icon,omitempty" yaml:"icon,omitempty" toml:"icon,omitempty"`
+}
+
+// Command is a script that can be run on demand, for example, by pressing a
+// button in Home Assistant.
+type Command struct {
+	ID   string
+	Name string
+	Icon string
+}
+
+// newCommand creates a Command for the script at the given path from the
+// command metadata the script output. Any fields not set by the script are
+// derived from the script file name.
+func newCommand(path string, c *scriptCommand) *Command {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	cmd := &Command{
+		ID:   c.ID,
+		Name: c.Name,
+		Icon: c.Icon,
+	}
+	if cmd.ID == "" {
+		cmd.ID = strcase.ToSnake(base)
+	}
+	if cmd.Name == "" {
+		cmd.Name = base
+	}
+	if cmd.Icon == "" {
+		cmd.Icon = "mdi:script-text-play"
+	}
+	return cmd
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scripts
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Event is something that happens on the device that scripts can be run on.
+type Event string
+
+const (
+	// EventStartup happens once, when the agent starts running scripts.
+	EventStartup Event = "startup"
+	// EventResume happens when the device resumes from suspend.
+	EventResume Event = "resume"
+	// EventNetwork happens when a network connection changes state.
+	EventNetwork Event = "network"
+	// EventUnlock happens when the screen is unlocked.
+	EventUnlock Event = "unlock"
+)
+
+// eventPrefix is the prefix for event keywords in a script schedule.
+const eventPrefix = "@on:"
+
+var validEvents = []Event{EventStartup, EventResume, EventNetwork, EventUnlock}
+
+// parseSchedule splits a script schedule into its cron expression and any event
+// keywords (e.g., "@on:resume"). Either may be empty. An error is returned if
+// the schedule contains an unknown event.
+func parseSchedule(schedule string) (string, []Event, error) {
+	var cronFields []string
+	var events []Event
+	for _, field := range strings.Fields(schedule) {
+		name, ok := strings.CutPrefix(field, eventPrefix)
+		if !ok {
+			cronFields = append(cronFields, field)
+			continue
+		}
+		event := Event(name)
+		if !slices.Contains(validEvents, event) {
+			return "", nil, fmt.Errorf("unknown event %q", field)
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	return strings.Join(cronFields, " "), events, nil
+}
+
+// eventTrigger returns the trigger passed to a script when it is run for the
+// given event.
+func eventTrigger(event Event) string {
+	return strings.TrimPrefix(eventPrefix, "@") + string(event)
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scripts
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrWorldWritable = errors.New("script is world-writable")
+	ErrNotOwner      = errors.New("script is not owned by the user running the agent")
+)
+
+// shellPath is the shell used to apply resource limits to scripts.
+const shellPath = "/bin/sh"
+
+// resourceLimits are optional limits applied to a running script.
+type resourceLimits struct {
+	cpuSeconds  uint64
+	memoryBytes uint64
+}
+
+// wrap returns the command and arguments to run the script at the given path
+// with the resource limits applied. The limits are set by a shell that then
+// execs the script, so they apply before the script (or any child it forks)
+// starts running. It is safe to call on a nil resourceLimits.
+func (l *resourceLimits) wrap(path string) (string, []string) {
+	if l == nil || (l.cpuSeconds == 0 && l.memoryBytes == 0) {
+		return path, nil
+	}
+	var limits []string
+	if l.cpuSeconds > 0 {
+		limits = append(limits, fmt.Sprintf("ulimit -t %d", l.cpuSeconds))
+	}
+	if l.memoryBytes > 0 {
+		// ulimit takes the memory limit in KiB.
+		limits = append(limits, fmt.Sprintf("ulimit -v %d", (l.memoryBytes+1023)/1024))
+	}
+	return shellPath, []string{"-c", strings.Join(limits, " && ") + ` && exec "$0" "$@"`, path}
+}
+
+// setProcessGroup ensures the command is run in its own process group, so that
+// it and any children it spawns can be signalled together.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateProcessGroup sends SIGTERM to the process group of the given
+// process. If the group is still around after the grace period, it is sent
+// SIGKILL.
+func terminateProcessGroup(p *os.Process, grace time.Duration) error {
+	if p == nil {
+		return nil
+	}
+	pgid := -p.Pid
+	if err := syscall.Kill(pgid, syscall.SIGTERM); err != nil {
+		return err
+	}
+	time.AfterFunc(grace, func() {
+		// The group may have already exited, so ignore any error.
+		_ = syscall.Kill(pgid, syscall.SIGKILL)
+	})
+	return nil
+}
+
+// checkPermissions ensures the script at the given path is owned by the user
+// running the agent and is not writable by others.
+func checkPermissions(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Perm()&0o002 != 0 {
+		return ErrWorldWritable
+	}
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return ErrNotOwner
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scripts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+// reloadDelay is how long to wait after the last change to a script before
+// reloading it. Editors will often generate several events when saving a file.
+const reloadDelay = time.Second
+
+// Runner schedules and runs all the scripts in a directory. It watches the
+// directory for changes, so that new scripts are scheduled, removed scripts are
+// unscheduled and modified scripts are re-probed for a new schedule. Scripts
+// with events in their schedule are run when the event is passed to Trigger.
+type Runner struct {
+	ctx      context.Context
+	cron     *cron.Cron
+	scripts  map[string]*runningScript
+	timers   map[string]*time.Timer
+	sensorCh chan tracker.Sensor
+	cmdsCh   chan struct{}
+	path     string
+	mu       sync.Mutex
+	reloadMu sync.Mutex
+}
+
+// runningScript tracks a script that the runner has scheduled or started.
+type runningScript struct {
+	*script
+	cancelFunc context.CancelFunc
+	entryID    cron.EntryID
+}
+
+// NewRunner creates a new Runner for the scripts in the given path. Scripts are
+// not run until Start is called.
+func NewRunner(ctx context.Context, path string) *Runner {
+	return &Runner{
+		ctx:      ctx,
+		cron:     cron.New(),
+		scripts:  make(map[string]*runningScript),
+		timers:   make(map[string]*time.Timer),
+		sensorCh: make(chan tracker.Sensor),
+		cmdsCh:   make(chan struct{}, 1),
+		path:     path,
+	}
+}
+
+// Sensors returns a channel on which any sensors output by scripts will be
+// sent.
+func (r *Runner) Sensors() <-chan tracker.Sensor {
+	return r.sensorCh
+}
+
+// Commands returns the commands provided by the scripts the runner has added,
+// sorted by ID.
+func (r *Runner) Commands() []*Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var cmds []*Command
+	for _, rs := range r.scripts {
+		if cmd := rs.Command(); cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+	}
+	slices.SortFunc(cmds, func(a, b *Command) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return cmds
+}
+
+// CommandsChanged returns a channel that receives a value whenever the
+// commands provided by scripts may have changed. Use Commands to retrieve the
+// current commands.
+func (r *Runner) CommandsChanged() <-chan struct{} {
+	return r.cmdsCh
+}
+
+// RunCommand runs the script providing the command with the given ID. Any
+// sensors it outputs are sent to the Sensors channel. It blocks until the
+// script has finished.
+func (r *Runner) RunCommand(id string) error {
+	rs := r.findCommand(id)
+	if rs == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, id)
+	}
+	log.Debug().Str("script", rs.Path()).Str("command", id).
+		Msg("Running script command.")
+	rs.run(triggerCommand)
+	return nil
+}
+
+// findCommand returns the script that provides the command with the given ID,
+// or nil if there is no such script.
+func (r *Runner) findCommand(id string) *runningScript {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rs := range r.scripts {
+		if cmd := rs.Command(); cmd != nil && cmd.ID == id {
+			return rs
+		}
+	}
+	return nil
+}
+
+// commandsChanged notifies any listener that the commands may have changed.
+func (r *Runner) commandsChanged() {
+	select {
+	case r.cmdsCh <- struct{}{}:
+	default:
+	}
+}
+
+// Start will add all scripts currently in the runner's path, start running
+// them and watch the path for changes. It blocks until the runner's context is
+// cancelled.
+func (r *Runner) Start() error {
+	files, err := filepath.Glob(r.path + "/*")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		r.reload(file)
+	}
+	log.Debug().Msg("Starting cron scheduler for script sensors.")
+	r.cron.Start()
+	r.Trigger(EventStartup)
+
+	if err := r.watch(); err != nil {
+		log.Warn().Err(err).Str("path", r.path).
+			Msg("Could not watch scripts directory. Changes to scripts will not be picked up.")
+	}
+
+	<-r.ctx.Done()
+	log.Debug().Msg("Stopping cron scheduler for script sensors.")
+	cronCtx := r.cron.Stop()
+	<-cronCtx.Done()
+	return nil
+}
+
+// watch sets up a watch on the runner's path. Any changes to files are
+// debounced and then the affected script is reloaded.
+func (r *Runner) watch() error {
+	if _, err := os.Stat(r.path); errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(r.path); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				log.Trace().Str("script", event.Name).Str("op", event.Op.String()).
+					Msg("Script changed.")
+				r.queueReload(event.Name)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Msg("Error watching scripts directory.")
+			}
+		}
+	}()
+	log.Debug().Str("path", r.path).Msg("Watching scripts directory for changes.")
+	return nil
+}
+
+// queueReload will reload the script at the given path once no further changes
+// have been seen for it for a short time.
+func (r *Runner) queueReload(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.timers[path]; ok {
+		t.Reset(reloadDelay)
+		return
+	}
+	r.timers[path] = time.AfterFunc(reloadDelay, func() {
+		r.mu.Lock()
+		delete(r.timers, path)
+		r.mu.Unlock()
+		r.reload(path)
+	})
+}
+
+// reload will (re)add the script at the given path. Any existing script at the
+// path is removed first. If the path is no longer an executable file, the
+// script is only removed.
+func (r *Runner) reload(path string) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	defer r.commandsChanged()
+	r.remove(path)
+	if r.ctx.Err() != nil || !isExecutable(path) {
+		return
+	}
+	ctx, cancelFunc := context.WithCancel(r.ctx)
+	s := NewScript(ctx, path)
+	if s == nil {
+		cancelFunc()
+		return
+	}
+	s.Output = r.sensorCh
+	s.scheduleChanged = func(schedule string) {
+		go r.reschedule(path, schedule)
+	}
+	rs := &runningScript{
+		script:     s,
+		cancelFunc: cancelFunc,
+	}
+	if !r.add(rs) {
+		cancelFunc()
+		return
+	}
+	r.mu.Lock()
+	r.scripts[path] = rs
+	r.mu.Unlock()
+}
+
+// add will start a streaming script or schedule a script with the cron
+// scheduler. It returns false if the script could not be added.
+func (r *Runner) add(rs *runningScript) bool {
+	if cmd := rs.Command(); cmd != nil {
+		if other := r.findCommand(cmd.ID); other != nil {
+			log.Warn().Str("script", rs.Path()).Str("command", cmd.ID).Str("other_script", other.Path()).
+				Msg("Script command ID is already used by another script. Not adding.")
+			return false
+		}
+	}
+	if rs.IsStreaming() {
+		go rs.Stream()
+		log.Debug().Str("script", rs.Path()).
+			Msg("Added streaming script sensor.")
+		return true
+	}
+	spec, events := rs.CronSpec(), rs.Events()
+	if spec == "" && len(events) == 0 {
+		if rs.Command() != nil {
+			log.Debug().Str("script", rs.Path()).Str("command", rs.Command().ID).
+				Msg("Added script command.")
+			return true
+		}
+		log.Warn().Str("script", rs.Path()).
+			Msg("Script has no schedule. Not adding.")
+		return false
+	}
+	if spec != "" {
+		id, err := r.cron.AddJob(spec, rs)
+		if err != nil {
+			log.Warn().Err(err).Str("script", rs.Path()).
+				Msg("Unable to schedule script.")
+			return false
+		}
+		rs.entryID = id
+	}
+	log.Debug().Str("schedule", rs.Schedule()).Str("script", rs.Path()).
+		Msg("Added script sensor.")
+	return true
+}
+
+// Trigger runs all scripts that have the given event in their schedule. The
+// scripts are run in the background.
+func (r *Runner) Trigger(event Event) {
+	r.mu.Lock()
+	var triggered []*runningScript
+	for _, rs := range r.scripts {
+		if slices.Contains(rs.Events(), event) {
+			triggered = append(triggered, rs)
+		}
+	}
+	r.mu.Unlock()
+	for _, rs := range triggered {
+		log.Debug().Str("script", rs.Path()).Str("event", string(event)).
+			Msg("Running script for event.")
+		go rs.run(eventTrigger(event))
+	}
+}
+
+// remove will stop and unschedule the script at the given path, if there is
+// one.
+func (r *Runner) remove(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rs, ok := r.scripts[path]
+	if !ok {
+		return
+	}
+	delete(r.scripts, path)
+	if rs.entryID != 0 {
+		r.cron.Remove(rs.entryID)
+	}
+	rs.cancelFunc()
+	log.Debug().Str("script", path).Msg("Removed script sensor.")
+}
+
+// reschedule will update the schedule of the script at the given path.
+func (r *Runner) reschedule(path, schedule string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rs, ok := r.scripts[path]
+	if !ok || rs.IsStreaming() {
+		return
+	}
+	log.Debug().Str("script", path).
+		Str("old_schedule", rs.Schedule()).Str("new_schedule", schedule).
+		Msg("Script schedule changed.")
+	if err := validateSchedule(schedule); err != nil {
+		log.Warn().Err(err).Str("script", path).
+			Msg("Unable to reschedule script. Keeping existing schedule.")
+		return
+	}
+	var id cron.EntryID
+	if spec, _, _ := parseSchedule(schedule); spec != "" {
+		var err error
+		if id, err = r.cron.AddJob(spec, rs); err != nil {
+			log.Warn().Err(err).Str("script", path).
+				Msg("Unable to reschedule script. Keeping existing schedule.")
+			return
+		}
+	}
+	if rs.entryID != 0 {
+		r.cron.Remove(rs.entryID)
+	}
+	rs.entryID = id
+	rs.setSchedule(schedule)
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scripts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scheduledScript returns the contents of a script that outputs the given
+// schedule.
+func scheduledScript(schedule string) string {
+	return `echo '{"schedule":"` + schedule + `"}'`
+}
+
+// cronEntries returns the number of jobs scheduled by the runner.
+func cronEntries(r *Runner) int {
+	return len(r.cron.Entries())
+}
+
+func TestRunner_reload(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRunner(context.TODO(), dir)
+	path := filepath.Join(dir, "script")
+
+	// A new executable is added and scheduled.
+	writeScript(t, path, scheduledScript("@every 5s"), 0o700)
+	r.reload(path)
+	rs, ok := r.scripts[path]
+	if !ok {
+		t.Fatalf("Runner.reload() did not add %s", path)
+	}
+	if got := rs.Schedule(); got != "@every 5s" {
+		t.Errorf("Runner.reload() schedule = %q, want %q", got, "@every 5s")
+	}
+	if got := cronEntries(r); got != 1 {
+		t.Errorf("Runner.reload() scheduled %d jobs, want 1", got)
+	}
+
+	// A changed script is re-probed for its schedule and rescheduled.
+	writeScript(t, path, scheduledScript("@every 1m"), 0o700)
+	r.reload(path)
+	rs, ok = r.scripts[path]
+	if !ok {
+		t.Fatalf("Runner.reload() removed changed script %s", path)
+	}
+	if got := rs.Schedule(); got != "@every 1m" {
+		t.Errorf("Runner.reload() schedule = %q, want %q", got, "@every 1m")
+	}
+	if got := cronEntries(r); got != 1 {
+		t.Errorf("Runner.reload() scheduled %d jobs, want 1", got)
+	}
+
+	// A file that is not executable is not added.
+	other := filepath.Join(dir, "other")
+	writeScript(t, other, scheduledScript("@every 5s"), 0o600)
+	r.reload(other)
+	if _, ok := r.scripts[other]; ok {
+		t.Errorf("Runner.reload() added non-executable %s", other)
+	}
+
+	// A deleted script is unscheduled.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	r.reload(path)
+	if _, ok := r.scripts[path]; ok {
+		t.Errorf("Runner.reload() did not remove deleted %s", path)
+	}
+	if got := cronEntries(r); got != 0 {
+		t.Errorf("Runner.reload() scheduled %d jobs, want 0", got)
+	}
+	if rs.ctx.Err() == nil {
+		t.Error("Runner.reload() did not stop deleted script")
+	}
+}
+
+func TestRunner_reschedule(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRunner(context.TODO(), dir)
+	path := filepath.Join(dir, "script")
+	writeScript(t, path, scheduledScript("@every 5s"), 0o700)
+	r.reload(path)
+	rs, ok := r.scripts[path]
+	if !ok {
+		t.Fatalf("Runner.reload() did not add %s", path)
+	}
+	oldID := rs.entryID
+
+	r.reschedule(path, "@every 1m")
+	if got := rs.Schedule(); got != "@every 1m" {
+		t.Errorf("Runner.reschedule() schedule = %q, want %q", got, "@every 1m")
+	}
+	if rs.entryID == oldID || r.cron.Entry(oldID).Valid() {
+		t.Error("Runner.reschedule() did not replace the scheduled job")
+	}
+	if got := cronEntries(r); got != 1 {
+		t.Errorf("Runner.reschedule() scheduled %d jobs, want 1", got)
+	}
+
+	// An invalid schedule keeps the existing one.
+	r.reschedule(path, "not a schedule")
+	if got := rs.Schedule(); got != "@every 1m" {
+		t.Errorf("Runner.reschedule() schedule = %q, want %q", got, "@every 1m")
+	}
+}
+
+func TestRunner_queueReload(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRunner(context.TODO(), dir)
+	path := filepath.Join(dir, "script")
+	probes := filepath.Join(dir, "probes")
+	// Record each time the script is run.
+	writeScript(t, path, `echo probe >> "`+probes+`"
+`+scheduledScript("@every 5s"), 0o700)
+
+	// A burst of events for the script is merged into a single reload.
+	for range 5 {
+		r.queueReload(path)
+		time.Sleep(reloadDelay / 10)
+	}
+	deadline := time.Now().Add(reloadDelay * 3)
+	for {
+		r.mu.Lock()
+		_, added := r.scripts[path]
+		r.mu.Unlock()
+		if added {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Runner.queueReload() did not reload %s", path)
+		}
+		time.Sleep(reloadDelay / 10)
+	}
+	// Wait long enough for any further reloads to have happened.
+	time.Sleep(reloadDelay + reloadDelay/2)
+
+	b, err := os.ReadFile(probes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(b), "probe"); got != 1 {
+		t.Errorf("Runner.queueReload() probed script %d times, want 1", got)
+	}
+}
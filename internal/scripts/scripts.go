@@ -6,11 +6,19 @@
 package scripts
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/iancoleman/strcase"
 	"github.com/pelletier/go-toml/v2"
@@ -21,21 +29,113 @@ import (
 	"github.com/joshuar/go-hass-agent/internal/tracker"
 )
 
+const (
+	// DefaultTimeout is how long a script is allowed to run if it does not
+	// specify its own timeout.
+	DefaultTimeout = 30 * time.Second
+	// killGracePeriod is how long a script is given to exit after being sent
+	// SIGTERM before it is sent SIGKILL.
+	killGracePeriod = 5 * time.Second
+	// maxOutputSize is the maximum amount of output (in bytes) that will be
+	// captured from a script.
+	maxOutputSize = 1 << 20
+)
+
+// The reason a script is being run is passed to it in the triggerEnv environment
+// variable.
+const (
+	triggerEnv      = "GO_HASS_AGENT_TRIGGER"
+	triggerProbe    = "probe"
+	triggerSchedule = "schedule"
+	triggerStream   = "stream"
+	triggerCommand  = "command"
+)
+
+var (
+	ErrOutputTooLarge = fmt.Errorf("script output exceeds %d bytes", maxOutputSize)
+	ErrNotExecutable  = errors.New("script is not executable")
+	ErrUnknownCommand = errors.New("no script provides command")
+)
+
 type script struct {
-	Output   chan tracker.Sensor
-	path     string
-	schedule string
+	ctx             context.Context
+	Output          chan tracker.Sensor
+	limits          *resourceLimits
+	cmd             *Command
+	scheduleChanged func(string)
+	path            string
+	schedule        string
+	cronSpec        string
+	events          []Event
+	timeout         time.Duration
+	mu              sync.Mutex
+	streaming       bool
 }
 
-func (s *script) execute() (*scriptOutput, error) {
-	cmd := exec.Command(s.path)
-	o, err := cmd.Output()
-	if err != nil {
+// command creates the command to run the script for the given trigger. The
+// command is run in its own process group, which will be terminated when the
+// given context is cancelled.
+func (s *script) command(ctx context.Context, trigger string) *exec.Cmd {
+	name, args := s.limits.wrap(s.path)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), triggerEnv+"="+trigger)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return terminateProcessGroup(cmd.Process, killGracePeriod)
+	}
+	cmd.WaitDelay = killGracePeriod + time.Second
+	return cmd
+}
+
+// start will start the given command, if the script's permissions are safe.
+func (s *script) start(cmd *exec.Cmd) error {
+	if err := checkPermissions(s.path); err != nil {
+		return err
+	}
+	return cmd.Start()
+}
+
+// execute runs the script to completion for the given trigger and parses its
+// output. When probing, if the first line of output is a header indicating the
+// script is a streaming script, the script is stopped and the header is
+// returned as the output.
+func (s *script) execute(trigger string) (*scriptOutput, error) {
+	ctx, cancelFunc := context.WithTimeout(s.ctx, s.timeout)
+	defer cancelFunc()
+
+	var header *scriptOutput
+	// Stop the script as soon as it produces too much output.
+	stdout := &limitedBuffer{max: maxOutputSize, overflow: cancelFunc}
+	if trigger == triggerProbe {
+		stdout.firstLine = func(line []byte) {
+			if header = parseStreamHeader(line); header != nil {
+				cancelFunc()
+			}
+		}
+	}
+	cmd := s.command(ctx, trigger)
+	cmd.Stdout = stdout
+
+	if err := s.start(cmd); err != nil {
 		return nil, err
 	}
+	if err := cmd.Wait(); err != nil {
+		switch {
+		case header != nil:
+			return header, nil
+		case stdout.exceeded:
+			return nil, ErrOutputTooLarge
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return nil, fmt.Errorf("script timed out after %s", s.timeout)
+		}
+		return nil, err
+	}
+	if header != nil {
+		return header, nil
+	}
+
 	output := &scriptOutput{}
-	err = output.Unmarshal(o)
-	if err != nil {
+	if err := output.Unmarshal(stdout.Bytes()); err != nil {
 		return nil, err
 	}
 	return output, nil
@@ -45,52 +145,165 @@ func (s *script) execute() (*scriptOutput, error) {
 // its specified schedule. It is implemented to satisfy the cron package
 // interface, so the script can be treated as a cron job. Run will execute the
 // script, collect the output and send it through a channel as a sensor object.
+// If the script outputs a different schedule than it is currently using, the
+// script's scheduleChanged function (if any) is called.
 func (s *script) Run() {
-	output, err := s.execute()
+	s.run(triggerSchedule)
+}
+
+// run executes the script for the given trigger and sends any valid sensors it
+// outputs through the script's output channel.
+func (s *script) run(trigger string) {
+	output, err := s.execute(trigger)
 	if err != nil {
 		log.Warn().Err(err).Str("script", s.path).
 			Msg("Could not run script.")
 		return
 	}
 
-	for _, o := range output.Sensors {
-		s.Output <- o
+	if output.Schedule != "" && output.Schedule != s.Schedule() && s.scheduleChanged != nil {
+		s.scheduleChanged(output.Schedule)
+	}
+
+	for _, o := range output.validSensors(s.path) {
+		select {
+		case s.Output <- o:
+		case <-s.ctx.Done():
+			return
+		}
 	}
 }
 
-// Schedule retrieves the cron schedule that the script should be run on.
+// Schedule retrieves the schedule that the script should be run on, as output
+// by the script.
 func (s *script) Schedule() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.schedule
 }
 
+// CronSpec retrieves the cron expression part of the script's schedule. It
+// will be empty if the script is not run by the cron scheduler.
+func (s *script) CronSpec() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cronSpec
+}
+
+// Events retrieves the events the script should be run on.
+func (s *script) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events
+}
+
+// setSchedule sets the schedule of the script. The schedule should already
+// have been validated with validateSchedule.
+func (s *script) setSchedule(schedule string) {
+	spec, events, _ := parseSchedule(schedule)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule = schedule
+	s.cronSpec = spec
+	s.events = events
+}
+
+// IsStreaming returns whether the script is a long-running streaming script
+// (as opposed to a script run on a schedule).
+func (s *script) IsStreaming() bool {
+	return s.streaming
+}
+
+// Command returns the command the script provides, or nil if it does not
+// provide one.
+func (s *script) Command() *Command {
+	return s.cmd
+}
+
 // Path returns the path to the script on disk.
 func (s *script) Path() string {
 	return s.path
 }
 
 // NewScript returns a new script object that can scheduled with the job
-// scheduler by the agent.
-func NewScript(p string) *script {
+// scheduler by the agent. The script will be run once to determine its
+// schedule, timeout, resource limits and command, or whether it is a streaming
+// script.
+// Any runs of the script will be cancelled when the given context is cancelled.
+func NewScript(ctx context.Context, p string) *script {
 	s := &script{
-		path:   p,
-		Output: make(chan tracker.Sensor),
+		ctx:     ctx,
+		path:    p,
+		timeout: DefaultTimeout,
+		Output:  make(chan tracker.Sensor),
 	}
-	o, err := s.execute()
+	o, err := s.execute(triggerProbe)
 	if err != nil {
 		log.Warn().Err(err).Str("script", p).
 			Msg("Cannot run script")
 		return nil
 	}
-	s.schedule = o.Schedule
+	if err := s.configure(o); err != nil {
+		log.Warn().Err(err).Str("script", p).
+			Msg("Invalid script configuration. Ignoring invalid fields.")
+	}
 	return s
 }
 
+// configure sets the schedule, timeout, resource limits and command of the
+// script from the given output. Any invalid fields are ignored (keeping the
+// defaults) and returned as an error.
+func (s *script) configure(o *scriptOutput) error {
+	var err error
+	s.streaming = o.Schedule == streamSchedule
+	switch {
+	case s.streaming:
+		s.schedule = o.Schedule
+	default:
+		if e := validateSchedule(o.Schedule); e != nil {
+			err = errors.Join(err, e)
+		} else {
+			s.setSchedule(o.Schedule)
+		}
+	}
+	if o.CPULimit > 0 || o.MemoryLimit > 0 {
+		s.limits = &resourceLimits{
+			cpuSeconds:  o.CPULimit,
+			memoryBytes: o.MemoryLimit,
+		}
+	}
+	if o.Timeout != "" {
+		if timeout, e := time.ParseDuration(o.Timeout); e != nil {
+			err = errors.Join(err, fmt.Errorf("timeout: %w", e))
+		} else if timeout <= 0 {
+			err = errors.Join(err, fmt.Errorf("timeout: must be positive (got %s)", o.Timeout))
+		} else {
+			s.timeout = timeout
+		}
+	}
+	if o.Command != nil {
+		switch {
+		case s.streaming:
+			err = errors.Join(err, errors.New("command: streaming scripts cannot be commands"))
+		case o.Command.ID != "" && !validSensorID.MatchString(o.Command.ID):
+			err = errors.Join(err, &invalidFieldError{field: "command.id", value: o.Command.ID, reason: "must only contain lowercase letters, numbers and underscores"})
+		default:
+			s.cmd = newCommand(s.path, o.Command)
+		}
+	}
+	return err
+}
+
 // scriptOutput represents the output from a script. The output must be
 // formatted as either valid JSON or YAML. This output is used to define a
 // sensor in Home Assistant.
 type scriptOutput struct {
-	Schedule string          `json:"schedule" yaml:"schedule"`
-	Sensors  []*scriptSensor `json:"sensors" yaml:"sensors"`
+	Schedule    string          `json:"schedule" yaml:"schedule" toml:"schedule"`
+	Timeout     string          `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+	Sensors     []*scriptSensor `json:"sensors" yaml:"sensors" toml:"sensors"`
+	CPULimit    uint64          `json:"cpu_limit,omitempty" yaml:"cpu_limit,omitempty" toml:"cpu_limit,omitempty"`
+	MemoryLimit uint64          `json:"memory_limit,omitempty" yaml:"memory_limit,omitempty" toml:"memory_limit,omitempty"`
+	Command     *scriptCommand  `json:"command,omitempty" yaml:"command,omitempty" toml:"command,omitempty"`
 }
 
 // Unmarshal will attempt to take the raw output from a script execution and
@@ -114,21 +327,30 @@ func (o *scriptOutput) Unmarshal(b []byte) error {
 }
 
 type scriptSensor struct {
-	SensorState       any    `json:"sensor_state" yaml:"sensor_state" toml:"sensor_state"`
-	SensorAttributes  any    `json:"sensor_attributes,omitempty" yaml:"sensor_attributes,omitempty" toml:"sensor_attributes,omitempty"`
-	SensorName        string `json:"sensor_name" yaml:"sensor_name" toml:"sensor_name"`
-	SensorIcon        string `json:"sensor_icon" yaml:"sensor_icon" toml:"sensor_icon"`
-	SensorDeviceClass string `json:"sensor_device_class,omitempty" yaml:"sensor_device_class,omitempty" toml:"sensor_device_class,omitempty"`
-	SensorStateClass  string `json:"sensor_state_class,omitempty" yaml:"sensor_state_class,omitempty" toml:"sensor_state_class,omitempty"`
-	SensorStateType   string `json:"sensor_type,omitempty" yaml:"sensor_type,omitempty" toml:"sensor_type,omitempty"`
-	SensorUnits       string `json:"sensor_units,omitempty" yaml:"sensor_units,omitempty" toml:"sensor_units,omitempty"`
+	SensorState             any      `json:"sensor_state" yaml:"sensor_state" toml:"sensor_state"`
+	SensorAttributes        any      `json:"sensor_attributes,omitempty" yaml:"sensor_attributes,omitempty" toml:"sensor_attributes,omitempty"`
+	SensorName              string   `json:"sensor_name" yaml:"sensor_name" toml:"sensor_name"`
+	SensorID                string   `json:"sensor_id,omitempty" yaml:"sensor_id,omitempty" toml:"sensor_id,omitempty"`
+	SensorIcon              string   `json:"sensor_icon" yaml:"sensor_icon" toml:"sensor_icon"`
+	SensorDeviceClass       string   `json:"sensor_device_class,omitempty" yaml:"sensor_device_class,omitempty" toml:"sensor_device_class,omitempty"`
+	SensorStateClass        string   `json:"sensor_state_class,omitempty" yaml:"sensor_state_class,omitempty" toml:"sensor_state_class,omitempty"`
+	SensorStateType         string   `json:"sensor_type,omitempty" yaml:"sensor_type,omitempty" toml:"sensor_type,omitempty"`
+	SensorUnits             string   `json:"sensor_units,omitempty" yaml:"sensor_units,omitempty" toml:"sensor_units,omitempty"`
+	SensorEntityCategory    string   `json:"sensor_entity_category,omitempty" yaml:"sensor_entity_category,omitempty" toml:"sensor_entity_category,omitempty"`
+	SensorOptions           []string `json:"sensor_options,omitempty" yaml:"sensor_options,omitempty" toml:"sensor_options,omitempty"`
+	SensorDisabledByDefault bool     `json:"sensor_disabled_by_default,omitempty" yaml:"sensor_disabled_by_default,omitempty" toml:"sensor_disabled_by_default,omitempty"`
 }
 
 func (s *scriptSensor) Name() string {
 	return s.SensorName
 }
 
+// ID returns the sensor_id of the sensor if set, otherwise an ID derived from
+// the sensor name.
 func (s *scriptSensor) ID() string {
+	if s.SensorID != "" {
+		return s.SensorID
+	}
 	return strcase.ToSnake(s.SensorName)
 }
 
@@ -146,10 +368,8 @@ func (s *scriptSensor) SensorType() sensor.SensorType {
 }
 
 func (s *scriptSensor) DeviceClass() sensor.SensorDeviceClass {
-	for d := sensor.Apparent_power; d <= sensor.Wind_speed; d++ {
-		if s.SensorDeviceClass == d.String() {
-			return d
-		}
+	if d, ok := parseDeviceClass(s.SensorDeviceClass); ok {
+		return d
 	}
 	return 0
 }
@@ -176,33 +396,192 @@ func (s *scriptSensor) Units() string {
 }
 
 func (s *scriptSensor) Category() string {
-	return ""
+	return s.SensorEntityCategory
 }
 
+// Attributes returns the sensor_attributes of the sensor. For enum sensors, the
+// sensor_options are added as an "options" attribute.
 func (s *scriptSensor) Attributes() any {
-	return s.SensorAttributes
+	if len(s.SensorOptions) == 0 {
+		return s.SensorAttributes
+	}
+	attrs := make(map[string]any)
+	if existing, ok := s.SensorAttributes.(map[string]any); ok {
+		for k, v := range existing {
+			attrs[k] = v
+		}
+	}
+	attrs["options"] = s.SensorOptions
+	return attrs
+}
+
+func (s *scriptSensor) DisabledByDefault() bool {
+	return s.SensorDisabledByDefault
+}
+
+var validSensorID = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// invalidFieldError is returned when a field of a script sensor is invalid.
+type invalidFieldError struct {
+	value  any
+	field  string
+	reason string
+}
+
+func (e *invalidFieldError) Error() string {
+	return fmt.Sprintf("%s: %s (got %v)", e.field, e.reason, e.value)
+}
+
+// validate checks the fields of the sensor. It returns an error describing all
+// invalid fields, or nil if the sensor is valid.
+func (s *scriptSensor) validate() error {
+	var err error
+	invalid := func(field string, value any, reason string) {
+		err = errors.Join(err, &invalidFieldError{field: field, value: value, reason: reason})
+	}
+
+	if s.SensorName == "" {
+		invalid("sensor_name", s.SensorName, "a sensor name is required")
+	}
+	if s.SensorID != "" && !validSensorID.MatchString(s.SensorID) {
+		invalid("sensor_id", s.SensorID, "must only contain lowercase letters, numbers and underscores")
+	}
+	switch s.SensorStateType {
+	case "", "binary":
+	default:
+		invalid("sensor_type", s.SensorStateType, `must be "binary" or not set`)
+	}
+	// Binary sensors have their own set of device classes which are not
+	// validated.
+	if s.SensorDeviceClass != "" && s.SensorType() != sensor.TypeBinary {
+		if _, ok := parseDeviceClass(s.SensorDeviceClass); !ok {
+			invalid("sensor_device_class", s.SensorDeviceClass, "unknown device class")
+		}
+	}
+	if s.SensorStateClass != "" && s.StateClass() == 0 {
+		invalid("sensor_state_class", s.SensorStateClass, `must be "measurement", "total" or "total_increasing"`)
+	}
+	switch s.SensorEntityCategory {
+	case "", "diagnostic", "config":
+	default:
+		invalid("sensor_entity_category", s.SensorEntityCategory, `must be "diagnostic", "config" or not set`)
+	}
+	if len(s.SensorOptions) > 0 {
+		if s.DeviceClass() != sensor.Enum {
+			invalid("sensor_options", s.SensorOptions, `options require sensor_device_class "enum"`)
+		} else if state, ok := s.SensorState.(string); !ok || !slices.Contains(s.SensorOptions, state) {
+			invalid("sensor_state", s.SensorState, "state must be one of sensor_options")
+		}
+	}
+	return err
+}
+
+// parseDeviceClass finds the sensor.SensorDeviceClass matching the given
+// string. The match ignores case and underscores, so both the Home Assistant
+// format (e.g., "data_size") and the sensor.SensorDeviceClass string
+// representation (e.g., "Data_size") will match.
+func parseDeviceClass(class string) (sensor.SensorDeviceClass, bool) {
+	normalise := func(s string) string {
+		return strings.ToLower(strings.ReplaceAll(s, "_", ""))
+	}
+	for d := sensor.Apparent_power; d <= sensor.Wind_speed; d++ {
+		if normalise(class) == normalise(d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// validSensors returns the valid sensors in the script output. Any invalid
+// sensors are logged and skipped.
+func (o *scriptOutput) validSensors(path string) []*scriptSensor {
+	var valid []*scriptSensor
+	for _, s := range o.Sensors {
+		if err := s.validate(); err != nil {
+			log.Error().Err(err).Str("script", path).Str("sensor", s.SensorName).
+				Msg("Invalid sensor in script output. Ignoring.")
+			continue
+		}
+		valid = append(valid, s)
+	}
+	return valid
 }
 
 // FindScripts locates scripts and returns a slice of scripts that the agent can
 // run.
-func FindScripts(path string) ([]*script, error) {
+func FindScripts(ctx context.Context, path string) ([]*script, error) {
 	var scripts []*script
-	files, err := filepath.Glob(path + "/*")
+	files, err := ScriptPaths(path)
 	if err != nil {
 		return nil, err
 	}
 	for _, s := range files {
-		if isExecutable(s) {
-			scripts = append(scripts, NewScript(s))
+		if script := NewScript(ctx, s); script != nil {
+			scripts = append(scripts, script)
 		}
 	}
 	return scripts, nil
 }
 
+// ScriptPaths returns the paths of the files in the given directory that are
+// treated as scripts (i.e., executable files).
+func ScriptPaths(dir string) ([]string, error) {
+	files, err := filepath.Glob(dir + "/*")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, file := range files {
+		if isExecutable(file) {
+			paths = append(paths, file)
+		}
+	}
+	return paths, nil
+}
+
+// isExecutable returns whether the given path is a regular file that is
+// executable.
 func isExecutable(filename string) bool {
 	fi, err := os.Stat(filename)
 	if err != nil {
 		return false
 	}
-	return fi.Mode().Perm()&0o111 != 0
+	return fi.Mode().IsRegular() && fi.Mode().Perm()&0o111 != 0
+}
+
+// limitedBuffer is a buffer that will refuse writes beyond a maximum size.
+// When that happens, the overflow function (if any) is called. If set, the
+// firstLine function is called once the first full line has been written.
+//
+// Note that bytes.Buffer is deliberately not embedded, so that its ReadFrom
+// method cannot be used by io.Copy to bypass Write.
+type limitedBuffer struct {
+	overflow  func()
+	firstLine func([]byte)
+	buf       bytes.Buffer
+	max       int
+	exceeded  bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.max {
+		if !b.exceeded && b.overflow != nil {
+			b.overflow()
+		}
+		b.exceeded = true
+		return 0, ErrOutputTooLarge
+	}
+	n, err := b.buf.Write(p)
+	if b.firstLine != nil {
+		if line, _, found := bytes.Cut(b.buf.Bytes(), []byte("\n")); found {
+			b.firstLine(line)
+			b.firstLine = nil
+		}
+	}
+	return n, err
+}
+
+// Bytes returns the contents of the buffer.
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
 }
@@ -0,0 +1,390 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scripts
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joshuar/go-hass-agent/internal/hass/sensor"
+	"github.com/joshuar/go-hass-agent/internal/tracker"
+)
+
+func Test_scriptSensor_ID(t *testing.T) {
+	tests := []struct {
+		name   string
+		sensor *scriptSensor
+		want   string
+	}{
+		{
+			name:   "id from name",
+			sensor: &scriptSensor{SensorName: "My Script Sensor"},
+			want:   "my_script_sensor",
+		},
+		{
+			name:   "explicit id",
+			sensor: &scriptSensor{SensorName: "My Renamed Sensor", SensorID: "my_script_sensor"},
+			want:   "my_script_sensor",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sensor.ID(); got != tt.want {
+				t.Errorf("scriptSensor.ID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_scriptSensor_validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		sensor    *scriptSensor
+		badFields []string
+	}{
+		{
+			name:   "valid sensor",
+			sensor: &scriptSensor{SensorName: "valid", SensorState: 1, SensorDeviceClass: "data_size", SensorStateClass: "measurement"},
+		},
+		{
+			name:   "valid binary sensor",
+			sensor: &scriptSensor{SensorName: "valid", SensorState: true, SensorStateType: "binary", SensorDeviceClass: "door"},
+		},
+		{
+			name:   "valid enum sensor",
+			sensor: &scriptSensor{SensorName: "valid", SensorState: "on", SensorDeviceClass: "enum", SensorOptions: []string{"on", "off"}},
+		},
+		{
+			name:      "missing name",
+			sensor:    &scriptSensor{SensorState: 1},
+			badFields: []string{"sensor_name"},
+		},
+		{
+			name:      "invalid id",
+			sensor:    &scriptSensor{SensorName: "invalid", SensorID: "Not An ID"},
+			badFields: []string{"sensor_id"},
+		},
+		{
+			name:      "invalid device class",
+			sensor:    &scriptSensor{SensorName: "invalid", SensorDeviceClass: "not_a_class"},
+			badFields: []string{"sensor_device_class"},
+		},
+		{
+			name:      "invalid state class and category",
+			sensor:    &scriptSensor{SensorName: "invalid", SensorStateClass: "sometimes", SensorEntityCategory: "debug"},
+			badFields: []string{"sensor_state_class", "sensor_entity_category"},
+		},
+		{
+			name:      "options without enum",
+			sensor:    &scriptSensor{SensorName: "invalid", SensorState: "on", SensorOptions: []string{"on", "off"}},
+			badFields: []string{"sensor_options"},
+		},
+		{
+			name:      "state not in options",
+			sensor:    &scriptSensor{SensorName: "invalid", SensorState: "maybe", SensorDeviceClass: "enum", SensorOptions: []string{"on", "off"}},
+			badFields: []string{"sensor_state"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sensor.validate()
+			if (err != nil) != (len(tt.badFields) > 0) {
+				t.Fatalf("scriptSensor.validate() error = %v, want errors for %v", err, tt.badFields)
+			}
+			for _, field := range tt.badFields {
+				var found bool
+				for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+					var fieldErr *invalidFieldError
+					if errors.As(e, &fieldErr) && fieldErr.field == field {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("scriptSensor.validate() error = %v, want error for %s", err, field)
+				}
+			}
+		})
+	}
+}
+
+func Test_parseDeviceClass(t *testing.T) {
+	tests := []struct {
+		name   string
+		class  string
+		want   sensor.SensorDeviceClass
+		wantOk bool
+	}{
+		{name: "home assistant format", class: "data_size", want: sensor.Data_size, wantOk: true},
+		{name: "string format", class: "Data_size", want: sensor.Data_size, wantOk: true},
+		{name: "camel case class", class: "energy_storage", want: sensor.EnergyStorage, wantOk: true},
+		{name: "prefixed class", class: "temperature", want: sensor.SensorTemperature, wantOk: true},
+		{name: "unknown class", class: "not_a_class", want: 0, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseDeviceClass(tt.class)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseDeviceClass() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+// writeScript writes a shell script with the given contents and mode to path.
+func writeScript(t *testing.T, path, contents string, mode os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+contents), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_script_execute(t *testing.T) {
+	dir := t.TempDir()
+	newScript := func(name, contents string, mode os.FileMode) *script {
+		path := filepath.Join(dir, name)
+		writeScript(t, path, contents, mode)
+		return &script{ctx: context.TODO(), path: path, timeout: time.Second}
+	}
+	limited := newScript("limited", `echo "{\"schedule\":\"@every 5s\",\"sensors\":[{\"sensor_name\":\"test\",\"sensor_state\":$(ulimit -t)}]}"`, 0o700)
+	limited.limits = &resourceLimits{cpuSeconds: 7, memoryBytes: 1 << 30}
+
+	tests := []struct {
+		script *script
+		want   *scriptOutput
+		name   string
+		probe  bool
+		err    bool
+	}{
+		{
+			name:   "valid output",
+			script: newScript("valid", `echo '{"schedule":"@every 5s","sensors":[{"sensor_name":"test","sensor_state":1}]}'`, 0o700),
+			want: &scriptOutput{
+				Schedule: "@every 5s",
+				Sensors:  []*scriptSensor{{SensorName: "test", SensorState: float64(1)}},
+			},
+		},
+		{
+			name:   "stream header",
+			script: newScript("stream", "echo '{\"schedule\":\"@stream\"}'\nsleep 10", 0o700),
+			probe:  true,
+			want:   &scriptOutput{Schedule: streamSchedule},
+		},
+		{
+			name:   "resource limits",
+			script: limited,
+			want: &scriptOutput{
+				Schedule: "@every 5s",
+				Sensors:  []*scriptSensor{{SensorName: "test", SensorState: float64(7)}},
+			},
+		},
+		{
+			name:   "timeout",
+			script: newScript("timeout", "sleep 10", 0o700),
+			err:    true,
+		},
+		{
+			name:   "too much output",
+			script: newScript("output", "yes", 0o700),
+			err:    true,
+		},
+		{
+			name:   "world-writable",
+			script: newScript("writable", `echo '{"schedule":"@every 5s"}'`, 0o777),
+			err:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trigger := triggerSchedule
+			if tt.probe {
+				trigger = triggerProbe
+			}
+			got, err := tt.script.execute(trigger)
+			if (err != nil) != tt.err {
+				t.Fatalf("script.execute() error = %v, wantErr %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("script.execute() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		wantErr  bool
+	}{
+		{name: "cron expression", schedule: "*/5 * * * *"},
+		{name: "descriptor", schedule: "@hourly"},
+		{name: "interval", schedule: "@every 30s"},
+		{name: "empty", schedule: ""},
+		{name: "event", schedule: "@on:resume"},
+		{name: "events and cron expression", schedule: "@on:startup @on:network @every 1h"},
+		{name: "invalid", schedule: "every 30s", wantErr: true},
+		{name: "unknown event", schedule: "@on:reboot", wantErr: true},
+		{name: "invalid cron expression with event", schedule: "@on:resume every 30s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateSchedule(tt.schedule); (err != nil) != tt.wantErr {
+				t.Errorf("validateSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_newCommand(t *testing.T) {
+	tests := []struct {
+		cmd  *scriptCommand
+		want *Command
+		name string
+		path string
+	}{
+		{
+			name: "defaults from file name",
+			path: "/scripts/backup-home.sh",
+			cmd:  &scriptCommand{},
+			want: &Command{ID: "backup_home", Name: "backup-home", Icon: "mdi:script-text-play"},
+		},
+		{
+			name: "all fields set",
+			path: "/scripts/backup-home.sh",
+			cmd:  &scriptCommand{ID: "backup", Name: "Backup Home", Icon: "mdi:backup-restore"},
+			want: &Command{ID: "backup", Name: "Backup Home", Icon: "mdi:backup-restore"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newCommand(tt.path, tt.cmd); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseSchedule(t *testing.T) {
+	tests := []struct {
+		name       string
+		schedule   string
+		wantSpec   string
+		wantEvents []Event
+		wantErr    bool
+	}{
+		{name: "cron expression", schedule: "30 * * * *", wantSpec: "30 * * * *"},
+		{name: "event", schedule: "@on:unlock", wantEvents: []Event{EventUnlock}},
+		{
+			name:       "combined",
+			schedule:   "@on:resume CRON_TZ=Asia/Tokyo 30 04 * * * @on:network @on:resume",
+			wantSpec:   "CRON_TZ=Asia/Tokyo 30 04 * * *",
+			wantEvents: []Event{EventResume, EventNetwork},
+		},
+		{name: "unknown event", schedule: "@on:shutdown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, events, err := parseSchedule(tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSchedule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if spec != tt.wantSpec || !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Errorf("parseSchedule() = %q, %v, want %q, %v", spec, events, tt.wantSpec, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestScriptPaths(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"script": 0o700, "data": 0o600} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Directories are not scripts, even though they are executable.
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ScriptPaths(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "script")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ScriptPaths() = %v, want %v", got, want)
+	}
+}
+
+func Test_script_stream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stream")
+	writeScript(t, path, `echo '{"schedule":"@stream"}'
+echo 'not json'
+echo ''
+echo '{"sensor_state":1}'
+echo '{"sensor_name":"first","sensor_state":1}'
+echo '{"sensor_name":"second","sensor_state":"two"}'
+`, 0o700)
+	s := &script{ctx: context.TODO(), path: path, Output: make(chan tracker.Sensor)}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.stream()
+		close(s.Output)
+	}()
+	var got []string
+	for sensor := range s.Output {
+		got = append(got, sensor.Name())
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("script.stream() error = %v", err)
+	}
+	// The header, malformed and invalid lines are skipped and each valid
+	// object becomes a sensor.
+	if want := []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("script.stream() sensors = %v, want %v", got, want)
+	}
+}
+
+func Test_script_Stream(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "restart")
+	// Output the number of times the script has run, then exit.
+	writeScript(t, path, `count="`+filepath.Join(dir, "count")+`"
+n=$(( $(cat "$count" 2>/dev/null || echo 0) + 1 ))
+echo $n > "$count"
+echo "{\"sensor_name\":\"runs\",\"sensor_state\":$n}"
+`, 0o700)
+	ctx, cancelFunc := context.WithCancel(context.TODO())
+	defer cancelFunc()
+	s := &script{ctx: ctx, path: path, Output: make(chan tracker.Sensor)}
+	go s.Stream()
+
+	var runs []time.Time
+	for len(runs) < 2 {
+		select {
+		case sensor := <-s.Output:
+			if want := float64(len(runs) + 1); sensor.State() != want {
+				t.Fatalf("script.Stream() run = %v, want %v", sensor.State(), want)
+			}
+			runs = append(runs, time.Now())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("script.Stream() did not restart the script, runs = %d", len(runs))
+		}
+	}
+	// The first restart waits for the initial backoff interval, less the
+	// maximum randomisation.
+	if delay := runs[1].Sub(runs[0]); delay < 250*time.Millisecond {
+		t.Errorf("script.Stream() restarted after %v, want a backoff", delay)
+	}
+}
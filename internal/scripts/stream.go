@@ -0,0 +1,128 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package scripts
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// streamSchedule is the schedule a script outputs in its header to
+	// indicate it is a streaming script.
+	streamSchedule = "@stream"
+	// streamStableRunTime is how long a streaming script needs to run before
+	// it is considered to have started successfully. If it exits after this
+	// time, it will be restarted immediately rather than backing off.
+	streamStableRunTime = time.Minute
+)
+
+// parseStreamHeader checks whether the given line of script output is a header
+// for a streaming script. If it is, the header is returned, otherwise nil.
+func parseStreamHeader(line []byte) *scriptOutput {
+	header := &scriptOutput{}
+	if err := json.Unmarshal(bytes.TrimSpace(line), header); err != nil {
+		return nil
+	}
+	if header.Schedule != streamSchedule {
+		return nil
+	}
+	return header
+}
+
+// parseStreamSensor parses a line of output from a streaming script as a
+// sensor. Blank lines and headers are skipped and nil is returned. An error is
+// returned if the line is not a valid sensor.
+func parseStreamSensor(line []byte) (*scriptSensor, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || parseStreamHeader(line) != nil {
+		return nil, nil
+	}
+	sensor := &scriptSensor{}
+	if err := json.Unmarshal(line, sensor); err != nil {
+		return nil, fmt.Errorf("could not parse output: %w", err)
+	}
+	if err := sensor.validate(); err != nil {
+		return nil, fmt.Errorf("sensor %q: %w", sensor.SensorName, err)
+	}
+	return sensor, nil
+}
+
+// Stream will start a streaming script and send any sensors it outputs through
+// the script's output channel. If the script exits, it is restarted with an
+// exponential backoff. Stream will return when the script's context is
+// cancelled.
+func (s *script) Stream() {
+	retry := backoff.NewExponentialBackOff()
+	retry.MaxElapsedTime = 0
+
+	for {
+		started := time.Now()
+		if err := s.stream(); err != nil {
+			log.Warn().Err(err).Str("script", s.path).
+				Msg("Streaming script exited.")
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > streamStableRunTime {
+			retry.Reset()
+		}
+		delay := retry.NextBackOff()
+		log.Debug().Str("script", s.path).Dur("delay", delay).
+			Msg("Restarting streaming script.")
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// stream runs the script once, reading newline-delimited JSON sensor objects
+// from its output until it exits.
+func (s *script) stream() error {
+	cmd := s.command(s.ctx, triggerStream)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := s.start(cmd); err != nil {
+		return err
+	}
+	log.Debug().Str("script", s.path).Msg("Started streaming script.")
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxOutputSize)
+	for scanner.Scan() {
+		sensor, err := parseStreamSensor(scanner.Bytes())
+		if err != nil {
+			log.Error().Err(err).Str("script", s.path).
+				Msg("Invalid streaming script output. Ignoring.")
+			continue
+		}
+		if sensor == nil {
+			continue
+		}
+		select {
+		case s.Output <- sensor:
+		case <-s.ctx.Done():
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Warn().Err(err).Str("script", s.path).
+			Msg("Problem reading streaming script output.")
+		// Make sure the script is stopped so Wait will return.
+		_ = terminateProcessGroup(cmd.Process, killGracePeriod)
+	}
+	return cmd.Wait()
+}
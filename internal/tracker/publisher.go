@@ -0,0 +1,33 @@
+// Copyright (c) 2024 Joshua Rich <joshua.rich@gmail.com>
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package tracker
+
+import (
+	"context"
+)
+
+// Publisher is an alternative to the Home Assistant mobile_app API for sending
+// sensor updates, such as MQTT. If a Publisher is embedded in the context
+// passed to UpdateSensors, sensor updates are sent using it instead.
+type Publisher interface {
+	PublishSensor(ctx context.Context, s Sensor) error
+}
+
+type publisherKey int
+
+var pubKey publisherKey
+
+// EmbedPublisherInContext will store the given Publisher in the context.
+func EmbedPublisherInContext(ctx context.Context, p Publisher) context.Context {
+	return context.WithValue(ctx, pubKey, p)
+}
+
+// publisherFromContext will attempt to fetch a Publisher from the given
+// context.
+func publisherFromContext(ctx context.Context) (Publisher, bool) {
+	p, ok := ctx.Value(pubKey).(Publisher)
+	return p, ok
+}
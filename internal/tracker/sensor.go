@@ -32,6 +32,20 @@ type Sensor interface {
 	Attributes() any
 }
 
+// DisabledByDefault is an optional interface a Sensor can implement to indicate
+// whether it should be disabled in Home Assistant when it is first registered.
+type DisabledByDefault interface {
+	DisabledByDefault() bool
+}
+
+// Availability is an optional interface a Sensor can implement to indicate
+// whether it is currently available (e.g., a disk usage sensor is unavailable
+// while the disk is unmounted). Sensors that do not implement it are always
+// available.
+type Availability interface {
+	Available() bool
+}
+
 func prettyPrintState(s Sensor) string {
 	var b strings.Builder
 	fmt.Fprintf(&b, "%v", s.State())
@@ -46,6 +60,9 @@ func marshallSensorState(state Sensor, registered bool) *sensor.SensorState {
 	s.StateAttributes = state.Attributes()
 	s.Icon = state.Icon()
 	s.State = state.State()
+	if a, ok := state.(Availability); ok && !a.Available() {
+		s.State = sensor.StateUnavailable
+	}
 	s.Type = marshalClass(state.SensorType())
 	s.UniqueID = state.ID()
 	s.Registered = registered
@@ -56,10 +73,19 @@ func marshallSensorState(state Sensor, registered bool) *sensor.SensorState {
 		s.UnitOfMeasurement = state.Units()
 		s.EntityCategory = state.Category()
 		s.Disabled = false
+		if d, ok := state.(DisabledByDefault); ok {
+			s.Disabled = d.DisabledByDefault()
+		}
 	}
 	return s
 }
 
+// RegistrationPayload returns the payload that is sent to Home Assistant to
+// register the given sensor.
+func RegistrationPayload(state Sensor) *sensor.SensorState {
+	return marshallSensorState(state, false)
+}
+
 type ComparableStringer interface {
 	comparable
 	String() string
@@ -84,9 +84,33 @@ func (t *SensorTracker) SensorList() []string {
 	return sortedEntities
 }
 
+// publish will send a sensor update using the given Publisher rather than the
+// Home Assistant API.
+func (t *SensorTracker) publish(ctx context.Context, p Publisher, sensorUpdate Sensor) {
+	if err := p.PublishSensor(ctx, sensorUpdate); err != nil {
+		log.Warn().Err(err).Str("id", sensorUpdate.ID()).
+			Msg("Failed to publish sensor data.")
+		return
+	}
+	log.Debug().
+		Str("name", sensorUpdate.Name()).
+		Str("id", sensorUpdate.ID()).
+		Str("state", prettyPrintState(sensorUpdate)).
+		Msg("Sensor published.")
+	if err := t.add(sensorUpdate); err != nil {
+		log.Warn().Err(err).
+			Str("name", sensorUpdate.Name()).
+			Msg("Unable to add state for sensor to tracker.")
+	}
+}
+
 // send will send a sensor update to HA, checking to ensure the sensor is not
 // disabled. It will also update the local registry state based on the response.
 func (t *SensorTracker) send(ctx context.Context, sensorUpdate Sensor) {
+	if p, ok := publisherFromContext(ctx); ok {
+		t.publish(ctx, p, sensorUpdate)
+		return
+	}
 	var req api.Request
 	if disabled := <-t.registry.IsDisabled(sensorUpdate.ID()); disabled {
 		log.Debug().Str("id", sensorUpdate.ID()).
@@ -8,6 +8,7 @@ package tracker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -326,6 +327,54 @@ func TestSensorTracker_send(t *testing.T) {
 	}
 }
 
+type publisherFunc func(ctx context.Context, s Sensor) error
+
+func (f publisherFunc) PublishSensor(ctx context.Context, s Sensor) error {
+	return f(ctx, s)
+}
+
+func TestSensorTracker_send_withPublisher(t *testing.T) {
+	mockSensor := &SensorMock{
+		IDFunc:         func() string { return "publishedID" },
+		NameFunc:       func() string { return "Published Sensor" },
+		UnitsFunc:      func() string { return "" },
+		StateFunc:      func() any { return "aState" },
+		AttributesFunc: func() any { return nil },
+	}
+	tests := []struct {
+		publishErr error
+		name       string
+		wantAdded  bool
+	}{
+		{
+			name:      "published",
+			wantAdded: true,
+		},
+		{
+			name:       "publish failed",
+			publishErr: errors.New("not connected"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var published []Sensor
+			ctx := EmbedPublisherInContext(context.TODO(), publisherFunc(func(_ context.Context, s Sensor) error {
+				published = append(published, s)
+				return tt.publishErr
+			}))
+			// The registry and API should not be used when publishing.
+			tr := &SensorTracker{
+				registry: &RegistryMock{},
+				sensor:   make(map[string]Sensor),
+			}
+			tr.send(ctx, mockSensor)
+			assert.Equal(t, []Sensor{mockSensor}, published)
+			_, err := tr.Get("publishedID")
+			assert.Equal(t, tt.wantAdded, err == nil)
+		})
+	}
+}
+
 func TestSensorTracker_handle(t *testing.T) {
 	mockUpdate := &SensorMock{
 		IDFunc:         func() string { return "updateID" },